@@ -2,25 +2,53 @@ package app
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"iter"
 	"path/filepath"
 	"strings"
+	"sync"
 
+	"github.com/HoskeOwl/PoorBookExtractor/internal/cache"
+	"github.com/HoskeOwl/PoorBookExtractor/internal/collation"
 	"github.com/HoskeOwl/PoorBookExtractor/internal/entities"
+	"github.com/HoskeOwl/PoorBookExtractor/internal/genres"
 	"github.com/HoskeOwl/PoorBookExtractor/internal/logs"
+	"github.com/HoskeOwl/PoorBookExtractor/internal/query"
+	"github.com/HoskeOwl/PoorBookExtractor/internal/settings"
+	"github.com/HoskeOwl/PoorBookExtractor/internal/sources/inp"
 	"github.com/HoskeOwl/PoorBookExtractor/internal/sources/inpx"
+	"github.com/HoskeOwl/PoorBookExtractor/internal/storage"
 	"github.com/HoskeOwl/PoorBookExtractor/internal/storage/memory"
 	"go.uber.org/zap"
-	"golang.org/x/exp/slices"
 )
 
 type App struct {
-	storage memory.MemoryStorage
+	storage storage.Storage
 	inpx    inpx.InpxParser
+	// libraries are loaded catalogs, books of each one are tagged with its ID
+	libraries     []*LoadedLibrary
+	lastLibraryID int
+	report        *inpx.ParseReport
+	// archiveMapping is the user rule to find archives, nil if not set
+	archiveMapping *inpx.MappingResolver
+	indexCache     *cache.Cache
+	// saving tracks indexes written in background
+	saving sync.WaitGroup
+
+	genres     *genres.Registry
+	genreLang  genres.Lang
+	nameFormat entities.NameFormat
+	// collator orders authors, series and books everywhere, the storage shares it
+	collator  *collation.Collator
+	bookOrder entities.BookOrder
+	// settings keeps the book order between sessions
+	settings *settings.Store
 
 	log *zap.Logger
 }
 
+// ExportBooks exports books into a directory per author, bookIDsByAuthor is keyed by author keys.
 func (a *App) ExportBooks(bookIDsByAuthor map[string][]string, directory string) error {
 	for author, book_ids := range bookIDsByAuthor {
 		books := a.storage.GetBooks(book_ids)
@@ -28,7 +56,7 @@ func (a *App) ExportBooks(bookIDsByAuthor map[string][]string, directory string)
 			a.log.Info("no books to export")
 			return nil
 		}
-		err := inpx.ExportBooks(filepath.Join(directory, author), books)
+		err := inpx.ExportBooks(filepath.Join(directory, a.AuthorName(author)), books)
 		if err != nil {
 			a.log.Error("error exporting books", zap.Error(err))
 			return err
@@ -38,42 +66,359 @@ func (a *App) ExportBooks(bookIDsByAuthor map[string][]string, directory string)
 	return nil
 }
 
+// selectionLibrary describes a catalog made of the books, it inherits the library of the books when all of them come from one.
+func (a *App) selectionLibrary(name string, books []*entities.Book) entities.Library {
+	library := entities.Library{Name: name, ID: name}
+	sources := make(map[string]bool)
+	for _, book := range books {
+		sources[book.Source] = true
+	}
+	if len(sources) == 1 {
+		if loaded, ok := a.GetLibraryByID(books[0].Source); ok {
+			library.Type = loaded.Library.Type
+			library.URL = loaded.Library.URL
+			library.Genres = loaded.Library.Genres
+			library.Description = fmt.Sprintf("Selection from %s", loaded.Title())
+		}
+	}
+	return library
+}
+
+// ExportCatalog writes a trimmed inpx with the books, bookKeys are book keys (see entities.Book.Key).
+func (a *App) ExportCatalog(bookKeys []string, path string) error {
+	books := a.storage.GetBooks(bookKeys)
+	if len(books) == 0 {
+		a.log.Info("no books to export")
+		return nil
+	}
+	library := a.selectionLibrary(strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)), books)
+	a.SortBooks(books)
+	if err := inpx.WriteInpx(path, library, books); err != nil {
+		a.log.Error("error writing catalog", zap.Error(err))
+		return err
+	}
+	a.log.Info("exported catalog", zap.String("path", path), zap.Int("count", len(books)))
+	return nil
+}
+
+// RepackBooks builds a portable library of the books in the directory, it is named after the directory.
+func (a *App) RepackBooks(bookKeys []string, directory string) error {
+	books := a.storage.GetBooks(bookKeys)
+	if len(books) == 0 {
+		a.log.Info("no books to export")
+		return nil
+	}
+	library := a.selectionLibrary(filepath.Base(directory), books)
+	if err := inpx.RepackBooks(directory, library, books); err != nil {
+		a.log.Error("error repacking books", zap.Error(err))
+		return err
+	}
+	a.log.Info("repacked books", zap.String("directory", directory), zap.Int("count", len(books)))
+	return nil
+}
+
 func NewApp(log *zap.Logger) *App {
-	storage := memory.NewMemoryStorage(nil)
-	return &App{
-		log:     log,
-		storage: *storage,
-		inpx:    *inpx.NewInpxParser(""),
+	return NewAppWithStorage(log, memory.NewMemoryStorage(nil))
+}
+
+// NewAppWithStorage creates the application keeping books in the given backend.
+func NewAppWithStorage(log *zap.Logger, store storage.Storage) *App {
+	a := &App{
+		log:        log,
+		storage:    store,
+		inpx:       *inpx.NewInpxParser(""),
+		indexCache: cache.NewDefault(),
+		genres:     genres.NewRegistry(),
+		genreLang:  genres.English,
+		settings:   settings.NewDefault(),
 	}
+	a.SetLocale(collation.English)
+	a.loadSettings()
+	return a
 }
 
+func (a *App) loadSettings() {
+	saved, err := a.settings.Load()
+	if err != nil {
+		a.log.Warn("error loading settings, using defaults", zap.Error(err))
+	}
+	a.bookOrder = entities.ParseBookOrder(saved.BookOrder)
+	a.storage.SetBookOrder(a.bookOrder)
+}
+
+/*
+ParseInpx loads the catalog as one more library next to already loaded ones.
+Opening the already loaded file reloads it keeping the library ID.
+The cached index is used when the catalog hasn't changed since it was parsed.
+*/
 func (a *App) ParseInpx(path string) error {
 	ctx := logs.WithLog(context.Background(), a.log, zap.String("action", "parse_inpx"))
-	books, err := a.inpx.ParseBooks(ctx, path)
+	loaded := a.findLibraryByPath(path)
+	if loaded != nil {
+		a.storage.RemoveSource(loaded.ID)
+	} else {
+		loaded = a.newLibrary(path)
+	}
+	if a.loadIndex(loaded) {
+		return nil
+	}
+	library, report, err := a.inpx.ParseBooksInto(ctx, loaded.Path, sourceSink{source: loaded.ID, storage: a.storage})
 	if err != nil {
+		_ = a.CloseLibrary(loaded.ID)
 		return err
 	}
-	a.log.Debug("parsed books", zap.Int("count", len(books)))
-	for _, book := range books {
-		a.storage.AddBook(&book)
-	}
+	loaded.Library = library
+	loaded.Report = report
+	a.report = report
+	a.rebuildGenres()
+	a.log.Debug("parsed books", zap.Int("count", a.storage.BooksLen()), zap.String("library", loaded.Title()),
+		zap.String("id", loaded.ID))
+	a.saveIndex(loaded)
 	return nil
 }
 
+// loadIndex restores the library from the index cache and reports whether it was cached.
+func (a *App) loadIndex(loaded *LoadedLibrary) bool {
+	index, _, err := a.indexCache.Load(loaded.Path, a.inpx.Options())
+	if err != nil {
+		if !errors.Is(err, cache.ErrMiss) {
+			a.log.Warn("error loading cached index", zap.String("path", loaded.Path), zap.Error(err))
+		}
+		return false
+	}
+	for idx := range index.Books {
+		index.Books[idx].Source = loaded.ID
+	}
+	a.storage.AddIndexed(index.Books, index.Authors)
+	loaded.Library = index.Library
+	loaded.Report = index.Report
+	a.report = index.Report
+	a.rebuildGenres()
+	a.log.Debug("loaded cached index", zap.Int("count", len(index.Books)), zap.String("library", loaded.Title()))
+	return true
+}
+
+// saveIndex caches the parsed library in background, the library is usable even if caching fails.
+func (a *App) saveIndex(loaded *LoadedLibrary) {
+	key, err := cache.NewKey(loaded.Path, a.inpx.Options())
+	if err != nil {
+		a.log.Warn("error caching index", zap.String("path", loaded.Path), zap.Error(err))
+		return
+	}
+	sourceBooks, authors := a.storage.ExportSource(loaded.ID)
+	index := &cache.Index{Library: loaded.Library, Books: make([]entities.Book, 0, len(sourceBooks)), Authors: authors, Report: loaded.Report}
+	for _, book := range sourceBooks {
+		stored := *book
+		stored.Source = ""
+		index.Books = append(index.Books, stored)
+	}
+	a.saving.Add(1)
+	go func() {
+		defer a.saving.Done()
+		if err := a.indexCache.Save(key, index); err != nil {
+			a.log.Warn("error caching index", zap.String("path", key.Path), zap.Error(err))
+			return
+		}
+		a.log.Debug("cached index", zap.String("path", key.Path), zap.Int("count", len(index.Books)))
+	}()
+}
+
+// Close waits for indexes being cached.
+func (a *App) Close() {
+	a.saving.Wait()
+}
+
+// RebuildIndex drops the cached index of the library and parses the catalog again.
+func (a *App) RebuildIndex(id string) error {
+	loaded, ok := a.GetLibraryByID(id)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownLibrary, id)
+	}
+	// an index being written would otherwise reappear after removal
+	a.saving.Wait()
+	if err := a.indexCache.Remove(loaded.Path); err != nil {
+		return err
+	}
+	return a.ParseInpx(loaded.Path)
+}
+
 func (a *App) GetAuthors(value string) []string {
 	return a.storage.GetAuthors(value)
 }
 
+func (a *App) SetNameFormat(format entities.NameFormat) {
+	a.nameFormat = format
+}
+
+// AuthorName formats the author with the selected name format, unknown keys are returned as is.
+func (a *App) AuthorName(key string) string {
+	author, ok := a.storage.GetAuthor(key)
+	if !ok {
+		return key
+	}
+	return a.FormatAuthor(author)
+}
+
+// FormatAuthor returns the name in the selected name format, the author doesn't have to be stored.
+func (a *App) FormatAuthor(author entities.Author) string {
+	return author.Format(a.nameFormat)
+}
+
 func (a *App) GetAuthorBooks(author string) []*entities.Book {
 	return a.storage.GetAuthorBooks(author)
 }
 
+func (a *App) GetAuthorsFiltered(value string, filter entities.BookFilter) []string {
+	return a.storage.GetAuthorsFiltered(value, filter)
+}
+
+// ListSeries returns keys of all series with books accepted by the filter.
+func (a *App) ListSeries(filter entities.BookFilter) []string {
+	return a.storage.GetSeriesFiltered("", filter)
+}
+
+// SearchSeries returns keys of series with all words of the value in their names.
+func (a *App) SearchSeries(value string, filter entities.BookFilter) []string {
+	return a.storage.GetSeriesFiltered(value, filter)
+}
+
+// SeriesName returns the series name by key, unknown keys are returned as is.
+func (a *App) SeriesName(key string) string {
+	name, ok := a.storage.GetSeriesName(key)
+	if !ok {
+		return key
+	}
+	return name
+}
+
+// GetSeriesBooksFiltered returns books of the series ordered by series number whatever the book order is.
+func (a *App) GetSeriesBooksFiltered(key string, filter entities.BookFilter) []*entities.Book {
+	return a.storage.GetSeriesBooksFiltered(key, filter)
+}
+
+func (a *App) SeriesLen() int {
+	return a.storage.SeriesLen()
+}
+
+// SearchBooks finds books by words of titles, series and keywords, the best matches go first.
+func (a *App) SearchBooks(query string, filter entities.BookFilter) []storage.BookMatch {
+	return a.storage.SearchBooks(query, filter)
+}
+
+// QueryBooks finds books by a field-qualified query (see query.Parse), errors describe the wrong term.
+func (a *App) QueryBooks(text string, filter entities.BookFilter) ([]*entities.Book, error) {
+	q, err := query.Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	return a.storage.QueryBooks(q, filter), nil
+}
+
+func (a *App) GetAuthorBooksFiltered(author string, filter entities.BookFilter) []*entities.Book {
+	return a.storage.GetAuthorBooksFiltered(author, filter)
+}
+
 func (a *App) GetProgress() int {
 	return a.inpx.GetProgress()
 }
 
 func (a *App) ClearStorage() {
 	a.storage.Clear()
+	a.libraries = nil
+	a.report = nil
+	a.rebuildGenres()
+}
+
+func (a *App) SetGenreLang(lang genres.Lang) {
+	a.genreLang = lang
+}
+
+// GenreNames returns human-readable genres of the book in the selected language.
+func (a *App) GenreNames(book *entities.Book) []string {
+	return a.genres.Names(book.Genres, a.genreLang)
+}
+
+// GenreName returns the human-readable genre in the selected language.
+func (a *App) GenreName(code string) string {
+	return a.genres.Name(code, a.genreLang)
+}
+
+// GroupGenres splits genre codes by categories named in the selected language.
+func (a *App) GroupGenres(codes []string) []genres.Group {
+	return a.genres.Group(codes, a.genreLang)
+}
+
+// FacetCounts counts books accepted by the filter per genre, language and year.
+func (a *App) FacetCounts(filter entities.BookFilter) storage.FacetCounts {
+	return a.storage.FacetCounts(filter)
+}
+
+// CountFacets counts facets of a result set, e.g. books found by a search.
+func (a *App) CountFacets(books []*entities.Book, filter entities.BookFilter) storage.FacetCounts {
+	return storage.CountFacets(func(yield func(*entities.Book) bool) {
+		for _, book := range books {
+			if !yield(book) {
+				return
+			}
+		}
+	}, filter)
+}
+
+// GetParseReport returns diagnostics of the last ParseInpx or nil if nothing is loaded.
+func (a *App) GetParseReport() *inpx.ParseReport {
+	return a.report
+}
+
+// SaveRejected writes records rejected by the last ParseInpx to the file.
+func (a *App) SaveRejected(path string) error {
+	if a.report == nil {
+		return nil
+	}
+	if err := a.report.SaveRejected(path); err != nil {
+		a.log.Error("error saving rejected records", zap.String("path", path), zap.Error(err))
+		return err
+	}
+	a.log.Info("saved rejected records", zap.String("path", path), zap.Int("count", a.report.Skipped()))
+	return nil
+}
+
+// SetDeletedMode changes how deleted books are loaded by the next ParseInpx.
+func (a *App) SetDeletedMode(mode inp.DeletedMode) {
+	a.inpx.SetDeletedMode(mode)
+}
+
+// SetDuplicatePolicy changes how repeated LibIDs are resolved by the next ParseInpx.
+func (a *App) SetDuplicatePolicy(policy inp.DuplicatePolicy) {
+	a.inpx.SetDuplicatePolicy(policy)
+}
+
+// SetEncoding forces the encoding of inp files read by the next ParseInpx, AutoEncoding detects it.
+func (a *App) SetEncoding(encoding inp.Encoding) {
+	a.inpx.SetEncoding(encoding)
+}
+
+// SetArchiveMapping sets the rule applied to inp names when archives are not found otherwise, empty pattern removes it.
+func (a *App) SetArchiveMapping(pattern, replacement string) error {
+	if pattern == "" {
+		a.archiveMapping = nil
+		a.inpx.SetArchiveMapping(nil)
+		return nil
+	}
+	mapping, err := inpx.NewMappingResolver(pattern, replacement)
+	if err != nil {
+		return err
+	}
+	a.archiveMapping = mapping
+	a.inpx.SetArchiveMapping(mapping)
+	return nil
+}
+
+// ArchiveMapping returns the pattern and the replacement of the archive mapping rule.
+func (a *App) ArchiveMapping() (string, string) {
+	if a.archiveMapping == nil {
+		return "", ""
+	}
+	return a.archiveMapping.Pattern(), a.archiveMapping.Replacement()
 }
 
 func (a *App) IterBooksByAuthor() iter.Seq2[string, []*entities.Book] {
@@ -84,10 +429,42 @@ func (a *App) IterByAuthors() iter.Seq[string] {
 	return a.storage.IterByAuthors()
 }
 
+// SetLocale changes the collation of authors, series and books in the storage and in lists the application sorts.
+func (a *App) SetLocale(locale collation.Locale) {
+	a.collator = collation.New(locale)
+	a.storage.SetCollator(a.collator)
+}
+
+func (a *App) Locale() collation.Locale {
+	return a.collator.Locale()
+}
+
+// SetBookOrder changes the order of books in the storage and in lists the application sorts, the order is saved for next sessions.
+func (a *App) SetBookOrder(order entities.BookOrder) {
+	a.bookOrder = order
+	a.storage.SetBookOrder(order)
+	if err := a.settings.Save(settings.Settings{BookOrder: order.String()}); err != nil {
+		a.log.Warn("error saving settings", zap.Error(err))
+	}
+}
+
+func (a *App) BookOrder() entities.BookOrder {
+	return a.bookOrder
+}
+
+// SortBooks orders books by the book order (see SetBookOrder).
 func (a *App) SortBooks(books []*entities.Book) {
-	slices.SortFunc(books, func(a, b *entities.Book) int {
-		return strings.Compare(a.FullName(), b.FullName())
-	})
+	a.collator.SortBooks(books, a.bookOrder)
+}
+
+// SortSeriesBooks orders books of one series by number in it, books with one number go by title.
+func (a *App) SortSeriesBooks(books []*entities.Book) {
+	a.collator.SortBooks(books, entities.BySeries)
+}
+
+// SortKeys orders author or series keys the way the storage lists them.
+func (a *App) SortKeys(keys []string) {
+	a.collator.Sort(keys)
 }
 
 func (a *App) Export(path string, books []*entities.Book) error {
@@ -107,6 +484,7 @@ func (a *App) BooksLen() int {
 	return a.storage.BooksLen()
 }
 
-func (a *App) GetBook(libID string) (*entities.Book, bool) {
-	return a.storage.GetBook(libID)
+// GetBook returns the book by its key (see entities.Book.Key).
+func (a *App) GetBook(key string) (*entities.Book, bool) {
+	return a.storage.GetBook(key)
 }
@@ -0,0 +1,112 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+
+	"github.com/HoskeOwl/PoorBookExtractor/internal/entities"
+	"github.com/HoskeOwl/PoorBookExtractor/internal/genres"
+	"github.com/HoskeOwl/PoorBookExtractor/internal/sources/inpx"
+	"github.com/HoskeOwl/PoorBookExtractor/internal/storage"
+)
+
+var ErrUnknownLibrary = errors.New("unknown library")
+
+// LoadedLibrary is one opened inpx, its ID is stored in entities.Book.Source of all its books.
+type LoadedLibrary struct {
+	ID      string
+	Path    string
+	Library entities.Library
+	Report  *inpx.ParseReport
+}
+
+// Title returns the library title or the inpx file name when the catalog has no collection.info.
+func (l *LoadedLibrary) Title() string {
+	if title := l.Library.Title(); title != "" {
+		return title
+	}
+	return filepath.Base(l.Path)
+}
+
+// sourceSink tags parsed books with the library they come from.
+type sourceSink struct {
+	source  string
+	storage storage.Storage
+}
+
+func (s sourceSink) AddBook(book *entities.Book) {
+	book.Source = s.source
+	s.storage.AddBook(book)
+}
+
+func (a *App) findLibrary(id string) (*LoadedLibrary, int) {
+	for idx, library := range a.libraries {
+		if library.ID == id {
+			return library, idx
+		}
+	}
+	return nil, -1
+}
+
+// libraryPath makes paths of one catalog equal however it is opened, like the index cache keys them.
+func libraryPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	return path
+}
+
+func (a *App) findLibraryByPath(path string) *LoadedLibrary {
+	path = libraryPath(path)
+	for _, library := range a.libraries {
+		if library.Path == path {
+			return library
+		}
+	}
+	return nil
+}
+
+func (a *App) newLibrary(path string) *LoadedLibrary {
+	a.lastLibraryID++
+	library := &LoadedLibrary{ID: strconv.Itoa(a.lastLibraryID), Path: libraryPath(path)}
+	a.libraries = append(a.libraries, library)
+	return library
+}
+
+// rebuildGenres applies catalog-specific genre names of all loaded libraries.
+func (a *App) rebuildGenres() {
+	a.genres = genres.NewRegistry()
+	for _, library := range a.libraries {
+		a.genres.Override(library.Library.Genres)
+	}
+}
+
+// GetLibraries returns loaded libraries in the order they were opened.
+func (a *App) GetLibraries() []*LoadedLibrary {
+	return a.libraries
+}
+
+func (a *App) GetLibraryByID(id string) (*LoadedLibrary, bool) {
+	library, _ := a.findLibrary(id)
+	return library, library != nil
+}
+
+// CloseLibrary removes the library and all its books.
+func (a *App) CloseLibrary(id string) error {
+	library, idx := a.findLibrary(id)
+	if library == nil {
+		return fmt.Errorf("%w: %s", ErrUnknownLibrary, id)
+	}
+	a.storage.RemoveSource(library.ID)
+	a.libraries = append(a.libraries[:idx], a.libraries[idx+1:]...)
+	if a.report == library.Report {
+		a.report = nil
+	}
+	a.rebuildGenres()
+	return nil
+}
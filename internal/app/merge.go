@@ -0,0 +1,202 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/HoskeOwl/PoorBookExtractor/internal/collation"
+	"github.com/HoskeOwl/PoorBookExtractor/internal/entities"
+	"github.com/HoskeOwl/PoorBookExtractor/internal/logs"
+	"github.com/HoskeOwl/PoorBookExtractor/internal/sources/inp"
+	"go.uber.org/zap"
+)
+
+type AuthorChanges struct {
+	// Author is the name as written in the merged books, removed authors aren't stored any more
+	Author  entities.Author
+	Added   int
+	Updated int
+	Removed int
+}
+
+// MergeSummary describes changes made by MergeInpx, Authors go in the order of author lists.
+type MergeSummary struct {
+	Added   int
+	Updated int
+	Removed int
+	Authors []AuthorChanges
+	// authors indexes Authors by author keys while merging
+	authors map[string]int
+}
+
+func (s *MergeSummary) author(author entities.Author) *AuthorChanges {
+	key := author.Key()
+	idx, ok := s.authors[key]
+	if !ok {
+		idx = len(s.Authors)
+		s.Authors = append(s.Authors, AuthorChanges{Author: author})
+		s.authors[key] = idx
+	}
+	return &s.Authors[idx]
+}
+
+func (s *MergeSummary) added(book *entities.Book) {
+	s.Added++
+	for _, author := range book.Authors {
+		s.author(author).Added++
+	}
+}
+
+// updated counts the change for authors of both versions of the book.
+func (s *MergeSummary) updated(old, book *entities.Book) {
+	s.Updated++
+	keys := make(map[string]bool)
+	for _, author := range slices.Concat(old.Authors, book.Authors) {
+		if keys[author.Key()] {
+			continue
+		}
+		keys[author.Key()] = true
+		s.author(author).Updated++
+	}
+}
+
+func (s *MergeSummary) removed(book *entities.Book) {
+	s.Removed++
+	for _, author := range book.Authors {
+		s.author(author).Removed++
+	}
+}
+
+/*
+MergeInpx layers a newer or delta catalog onto the loaded library by LibID.
+New books are added, changed ones replaced, books which the delta marks as deleted
+(or which are not accepted by the deleted mode any more) are removed.
+An empty libraryID is allowed when at most one library is loaded.
+*/
+func (a *App) MergeInpx(libraryID, path string) (*MergeSummary, error) {
+	ctx := logs.WithLog(context.Background(), a.log, zap.String("action", "merge_inpx"))
+	target, err := a.mergeTarget(libraryID, path)
+	if err != nil {
+		return nil, err
+	}
+	mode := a.inpx.DeletedMode()
+	// deleted records are needed to remove books from the loaded catalog
+	a.inpx.SetDeletedMode(inp.IncludeDeleted)
+	books, library, report, err := a.inpx.ParseBooks(ctx, path)
+	a.inpx.SetDeletedMode(mode)
+	if err != nil {
+		if target.Report == nil {
+			// the library was created for this merge only
+			_ = a.CloseLibrary(target.ID)
+		}
+		return nil, err
+	}
+
+	summary := &MergeSummary{Authors: make([]AuthorChanges, 0), authors: make(map[string]int)}
+	rebase := newRebaser(path, target.Path)
+	for _, book := range books {
+		book.Source = target.ID
+		rebase.book(&book)
+		old, exists := a.storage.GetBook(book.Key())
+		if !mode.Accept(&book) {
+			if exists {
+				a.storage.RemoveBook(book.Key())
+				summary.removed(old)
+			}
+			continue
+		}
+		if !exists {
+			a.storage.AddBook(&book)
+			summary.added(&book)
+			continue
+		}
+		if old.Equal(&book) {
+			continue
+		}
+		a.storage.AddBook(&book)
+		summary.updated(old, &book)
+	}
+	collation.SortFunc(a.collator, summary.Authors, func(changes AuthorChanges) string { return changes.Author.Key() })
+
+	if library.Version != "" {
+		target.Library.Version = library.Version
+		target.Library.Date = library.Date
+	}
+	if target.Library.Name == "" {
+		target.Library = library
+	}
+	if len(library.Genres) > 0 {
+		if target.Library.Genres == nil {
+			target.Library.Genres = make(map[string]string, len(library.Genres))
+		}
+		maps.Copy(target.Library.Genres, library.Genres)
+		a.rebuildGenres()
+	}
+	target.Report = report
+	a.report = report
+	a.log.Info("merged catalog", zap.String("path", path), zap.String("library", target.ID),
+		zap.Int("added", summary.Added), zap.Int("updated", summary.Updated), zap.Int("removed", summary.Removed))
+	return summary, nil
+}
+
+// mergeTarget finds the library to merge into, merging into nothing loads the update as a new library.
+func (a *App) mergeTarget(libraryID, path string) (*LoadedLibrary, error) {
+	if libraryID == "" {
+		switch len(a.libraries) {
+		case 0:
+			return a.newLibrary(path), nil
+		case 1:
+			return a.libraries[0], nil
+		default:
+			return nil, fmt.Errorf("%w: choose the library to merge into", ErrUnknownLibrary)
+		}
+	}
+	target, _ := a.findLibrary(libraryID)
+	if target == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownLibrary, libraryID)
+	}
+	return target, nil
+}
+
+/*
+rebaser moves books of a delta catalog to the root of the library they are merged into,
+the parser places them next to the delta inpx. Archives found only next to the delta stay there.
+*/
+type rebaser struct {
+	deltaRoot  string
+	targetRoot string
+	// delta tells whether the archive is found only next to the delta
+	delta map[string]bool
+}
+
+func newRebaser(deltaPath, targetPath string) *rebaser {
+	r := &rebaser{deltaRoot: filepath.Dir(deltaPath), targetRoot: filepath.Dir(targetPath), delta: make(map[string]bool)}
+	if abs, err := filepath.Abs(r.deltaRoot); err == nil {
+		r.deltaRoot = abs
+	}
+	if abs, err := filepath.Abs(r.targetRoot); err == nil {
+		r.targetRoot = abs
+	}
+	return r
+}
+
+func (r *rebaser) book(book *entities.Book) {
+	if r.deltaRoot == r.targetRoot || book.Metadata.Filepath != r.deltaRoot {
+		return
+	}
+	archive := book.Metadata.ArchiveName
+	delta, ok := r.delta[archive]
+	if !ok {
+		_, targetErr := os.Stat(filepath.Join(r.targetRoot, archive))
+		_, deltaErr := os.Stat(filepath.Join(r.deltaRoot, archive))
+		delta = targetErr != nil && deltaErr == nil
+		r.delta[archive] = delta
+	}
+	if !delta {
+		book.Metadata.Filepath = r.targetRoot
+	}
+}
@@ -0,0 +1,287 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/HoskeOwl/PoorBookExtractor/internal/entities"
+	"github.com/HoskeOwl/PoorBookExtractor/internal/storage"
+)
+
+/*
+Books are stored in a compact binary form: every book is a sequence of uvarints referring
+to the table of strings (authors, genres, archives and languages repeat a lot) which is written
+before books. The author index follows books, so loading skips indexing.
+Small parts (key, library, report) are gob blobs.
+The file ends with the CRC-32 of everything before it, so a damaged index is found before decoding.
+*/
+
+var errCorrupted = errors.New("corrupted index")
+
+type stringTable struct {
+	index   map[string]uint64
+	strings []string
+}
+
+func newStringTable() *stringTable {
+	return &stringTable{index: make(map[string]uint64)}
+}
+
+func (t *stringTable) ref(value string) uint64 {
+	if idx, ok := t.index[value]; ok {
+		return idx
+	}
+	idx := uint64(len(t.strings))
+	t.index[value] = idx
+	t.strings = append(t.strings, value)
+	return idx
+}
+
+type encoder struct {
+	w   *bufio.Writer
+	buf [binary.MaxVarintLen64]byte
+	err error
+}
+
+func (e *encoder) uvarint(value uint64) {
+	if e.err != nil {
+		return
+	}
+	n := binary.PutUvarint(e.buf[:], value)
+	_, e.err = e.w.Write(e.buf[:n])
+}
+
+func (e *encoder) varint(value int64) {
+	if e.err != nil {
+		return
+	}
+	n := binary.PutVarint(e.buf[:], value)
+	_, e.err = e.w.Write(e.buf[:n])
+}
+
+func (e *encoder) bytes(value []byte) {
+	e.uvarint(uint64(len(value)))
+	if e.err != nil {
+		return
+	}
+	_, e.err = e.w.Write(value)
+}
+
+func (e *encoder) blob(value any) {
+	if e.err != nil {
+		return
+	}
+	var buf bytes.Buffer
+	if e.err = gob.NewEncoder(&buf).Encode(value); e.err != nil {
+		return
+	}
+	e.bytes(buf.Bytes())
+}
+
+type decoder struct {
+	r       *bytes.Reader
+	strings []string
+	err     error
+}
+
+func newDecoder(data []byte) *decoder {
+	return &decoder{r: bytes.NewReader(data)}
+}
+
+// remaining returns the number of bytes not decoded yet.
+func (d *decoder) remaining() int64 {
+	return int64(d.r.Len())
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	var value uint64
+	value, d.err = binary.ReadUvarint(d.r)
+	return value
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	var value int64
+	value, d.err = binary.ReadVarint(d.r)
+	return value
+}
+
+/*
+count reads the length of a sequence whose elements take at least size bytes each.
+Lengths above the limit or longer than the rest of the data are corrupted,
+so a broken length never makes a huge allocation.
+*/
+func (d *decoder) count(limit uint64, size int) int {
+	value := d.uvarint()
+	if d.err == nil && (value > limit || value > uint64(d.remaining())/uint64(size)) {
+		d.err = fmt.Errorf("%w: length %d", errCorrupted, value)
+	}
+	if d.err != nil {
+		return 0
+	}
+	return int(value)
+}
+
+// index reads a position in a sequence of the length.
+func (d *decoder) index(length int) int {
+	value := d.uvarint()
+	if d.err == nil && value >= uint64(length) {
+		d.err = fmt.Errorf("%w: index %d of %d", errCorrupted, value, length)
+	}
+	if d.err != nil {
+		return 0
+	}
+	return int(value)
+}
+
+func (d *decoder) bytes() []byte {
+	size := d.count(1<<30, 1)
+	if d.err != nil {
+		return nil
+	}
+	value := make([]byte, size)
+	_, d.err = io.ReadFull(d.r, value)
+	return value
+}
+
+func (d *decoder) blob(value any) {
+	data := d.bytes()
+	if d.err != nil {
+		return
+	}
+	d.err = gob.NewDecoder(bytes.NewReader(data)).Decode(value)
+}
+
+func (d *decoder) string() string {
+	idx := d.uvarint()
+	if d.err != nil {
+		return ""
+	}
+	if idx >= uint64(len(d.strings)) {
+		d.err = fmt.Errorf("%w: string %d of %d", errCorrupted, idx, len(d.strings))
+		return ""
+	}
+	return d.strings[idx]
+}
+
+func (d *decoder) stringList() []string {
+	count := d.count(1<<20, 1)
+	if count == 0 {
+		return nil
+	}
+	values := make([]string, 0, count)
+	for range count {
+		values = append(values, d.string())
+	}
+	return values
+}
+
+func (e *encoder) stringList(table *stringTable, values []string) {
+	e.uvarint(uint64(len(values)))
+	for _, value := range values {
+		e.uvarint(table.ref(value))
+	}
+}
+
+func (e *encoder) book(table *stringTable, book *entities.Book) {
+	e.uvarint(table.ref(book.Metadata.ArchiveName))
+	e.uvarint(table.ref(book.Metadata.Filepath))
+	e.uvarint(uint64(len(book.Authors)))
+	for _, author := range book.Authors {
+		e.uvarint(table.ref(author.Last))
+		e.uvarint(table.ref(author.First))
+		e.uvarint(table.ref(author.Middle))
+	}
+	e.stringList(table, book.Genres)
+	e.uvarint(table.ref(book.Title))
+	e.uvarint(table.ref(book.Series))
+	e.uvarint(table.ref(book.SeriesNumber))
+	e.uvarint(table.ref(book.Filename))
+	e.varint(book.Size)
+	e.uvarint(table.ref(book.LibID))
+	deleted := uint64(0)
+	if book.Deleted {
+		deleted = 1
+	}
+	e.uvarint(deleted)
+	e.uvarint(table.ref(book.Ext))
+	e.varint(book.Date.Unix())
+	e.uvarint(table.ref(book.Lang))
+	e.varint(int64(book.Rating))
+	e.stringList(table, book.Keywords)
+	e.uvarint(table.ref(book.Folder))
+	e.uvarint(table.ref(book.Duplicate))
+}
+
+// minBookSize is the least number of bytes a book takes, one for every field.
+const minBookSize = 18
+
+func (d *decoder) book(book *entities.Book) {
+	book.Metadata.ArchiveName = d.string()
+	book.Metadata.Filepath = d.string()
+	if count := d.count(1<<16, 3); count > 0 {
+		book.Authors = make([]entities.Author, 0, count)
+		for range count {
+			book.Authors = append(book.Authors, entities.Author{Last: d.string(), First: d.string(), Middle: d.string()})
+		}
+	}
+	book.Genres = d.stringList()
+	book.Title = d.string()
+	book.Series = d.string()
+	book.SeriesNumber = d.string()
+	book.Filename = d.string()
+	book.Size = d.varint()
+	book.LibID = d.string()
+	book.Deleted = d.uvarint() == 1
+	book.Ext = d.string()
+	book.Date = time.Unix(d.varint(), 0).UTC()
+	book.Lang = d.string()
+	book.Rating = int(d.varint())
+	book.Keywords = d.stringList()
+	book.Folder = d.string()
+	book.Duplicate = d.string()
+}
+
+func (e *encoder) authors(table *stringTable, authors []storage.AuthorIndex) {
+	e.uvarint(uint64(len(authors)))
+	for _, author := range authors {
+		e.uvarint(table.ref(author.Key))
+		e.uvarint(table.ref(author.Author.Last))
+		e.uvarint(table.ref(author.Author.First))
+		e.uvarint(table.ref(author.Author.Middle))
+		e.uvarint(uint64(len(author.Books)))
+		for _, book := range author.Books {
+			e.uvarint(uint64(book))
+		}
+	}
+}
+
+func (d *decoder) authors(books int) []storage.AuthorIndex {
+	// an author takes a key, three names and the number of books
+	count := d.count(uint64(books)*(1<<16), 5)
+	authors := make([]storage.AuthorIndex, 0, count)
+	for range count {
+		author := storage.AuthorIndex{Key: d.string()}
+		author.Author = entities.Author{Last: d.string(), First: d.string(), Middle: d.string()}
+		author.Books = make([]int, 0, d.count(uint64(books), 1))
+		for range cap(author.Books) {
+			author.Books = append(author.Books, d.index(books))
+		}
+		if d.err != nil {
+			return nil
+		}
+		authors = append(authors, author)
+	}
+	return authors
+}
@@ -0,0 +1,189 @@
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/HoskeOwl/PoorBookExtractor/internal/entities"
+	"github.com/HoskeOwl/PoorBookExtractor/internal/sources/inp"
+	"github.com/HoskeOwl/PoorBookExtractor/internal/sources/inpx"
+	"github.com/HoskeOwl/PoorBookExtractor/internal/storage"
+)
+
+func testIndex() *Index {
+	strugatsky := entities.Author{Last: "Стругацкий", First: "Аркадий", Middle: "Натанович"}
+	lem := entities.Author{Last: "Lem", First: "Stanisław"}
+	return &Index{
+		Library: entities.Library{
+			Name:    "Test library",
+			ID:      "test",
+			Version: "20240131",
+			Date:    time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC),
+			Genres:  map[string]string{"sf_custom": "Своя фантастика"},
+		},
+		Books: []entities.Book{
+			{
+				Metadata:     entities.BookMetadata{ArchiveName: "fb2-000001-000002.zip", Filepath: "/library"},
+				Authors:      []entities.Author{strugatsky, {Last: "Стругацкий", First: "Борис", Middle: "Натанович"}},
+				Genres:       []string{"sf", "sf_custom"},
+				Title:        "Пикник на обочине",
+				Series:       "Миры братьев Стругацких",
+				SeriesNumber: "3",
+				Filename:     "1",
+				Size:         250000,
+				LibID:        "1",
+				Deleted:      true,
+				Ext:          "fb2",
+				Date:         time.Date(2015, 3, 2, 0, 0, 0, 0, time.UTC),
+				Lang:         "ru",
+				Rating:       5,
+				Keywords:     []string{"сталкер", "зона"},
+				Folder:       "fb2-000001-000002.zip",
+				Duplicate:    "fb2-000003-000004.zip.2",
+			},
+			{
+				Metadata: entities.BookMetadata{ArchiveName: "fb2-000001-000002.zip", Filepath: "/library"},
+				Authors:  []entities.Author{lem},
+				Title:    "Solaris",
+				Filename: "2",
+				Size:     1,
+				LibID:    "2",
+				Ext:      "epub",
+				Date:     time.Date(2001, 12, 31, 0, 0, 0, 0, time.UTC),
+				Lang:     "pl",
+			},
+		},
+		Authors: []storage.AuthorIndex{
+			{Key: strugatsky.Key(), Author: strugatsky, Books: []int{0}},
+			{Key: lem.Key(), Author: lem, Books: []int{1}},
+		},
+		Report: &inpx.ParseReport{
+			Books:      2,
+			Collisions: []inp.Collision{{LibID: "1", Existing: "fb2-000001-000002.zip", Incoming: "fb2-000003-000004.zip", Key: "1@fb2-000003-000004.zip.2"}},
+			Encodings:  map[string]inp.Encoding{"fb2-000001-000002.inp": inp.UTF8},
+		},
+	}
+}
+
+// saveTestIndex caches the index of an empty catalog file and returns the catalog path.
+func saveTestIndex(t *testing.T, c *Cache, index *Index) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "library.inpx")
+	if err := os.WriteFile(path, []byte("catalog"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	key, err := NewKey(path, "options")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Save(key, index); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestIndexRoundTrip(t *testing.T) {
+	c := New(t.TempDir())
+	index := testIndex()
+	path := saveTestIndex(t, c, index)
+
+	loaded, _, err := c.Load(path, "options")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.Books, index.Books) {
+		t.Errorf("books:\ngot  %+v\nwant %+v", loaded.Books, index.Books)
+	}
+	if !reflect.DeepEqual(loaded.Authors, index.Authors) {
+		t.Errorf("authors: got %+v, want %+v", loaded.Authors, index.Authors)
+	}
+	if !reflect.DeepEqual(loaded.Library, index.Library) {
+		t.Errorf("library: got %+v, want %+v", loaded.Library, index.Library)
+	}
+	if loaded.Report.Books != index.Report.Books || !reflect.DeepEqual(loaded.Report.Collisions, index.Report.Collisions) ||
+		!reflect.DeepEqual(loaded.Report.Encodings, index.Report.Encodings) {
+		t.Errorf("report: got %+v, want %+v", loaded.Report, index.Report)
+	}
+
+	if _, _, err := c.Load(path, "other options"); !errors.Is(err, ErrMiss) {
+		t.Errorf("index parsed with other options: got %v, want ErrMiss", err)
+	}
+}
+
+// loadAllocates loads the index and returns the error and the number of allocated bytes.
+func loadAllocates(c *Cache, path string) (error, uint64) {
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	_, _, err := c.Load(path, "options")
+	runtime.ReadMemStats(&after)
+	return err, after.TotalAlloc - before.TotalAlloc
+}
+
+func TestLoadDamagedIndex(t *testing.T) {
+	c := New(t.TempDir())
+	path := saveTestIndex(t, c, testIndex())
+	data, err := os.ReadFile(c.file(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	damaged := make([][]byte, 0)
+	for size := range len(data) {
+		damaged = append(damaged, data[:size])
+	}
+	for pos := range data {
+		broken := bytes.Clone(data)
+		broken[pos] ^= 0xff
+		damaged = append(damaged, broken)
+	}
+	for _, broken := range damaged {
+		if err := os.WriteFile(c.file(path), broken, 0644); err != nil {
+			t.Fatal(err)
+		}
+		err, allocated := loadAllocates(c, path)
+		if !errors.Is(err, ErrMiss) {
+			t.Fatalf("damaged index of %d bytes: got %v, want ErrMiss", len(broken), err)
+		}
+		if allocated > 1<<20 {
+			t.Fatalf("damaged index of %d bytes allocated %d bytes", len(broken), allocated)
+		}
+		if _, err := os.Stat(c.file(path)); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("damaged index of %d bytes is not removed", len(broken))
+		}
+	}
+}
+
+// TestReadIndexBounds damages lengths behind the checksum, they must never cause a panic or a huge allocation.
+func TestReadIndexBounds(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeIndex(&buf, Key{Path: "/library.inpx"}, testIndex()); err != nil {
+		t.Fatal(err)
+	}
+	body := buf.Bytes()[:buf.Len()-4]
+	d := newDecoder(body)
+	if _, err := io.ReadFull(d.r, make([]byte, len(magic))); err != nil {
+		t.Fatal(err)
+	}
+	d.blob(&header{})
+	start := len(body) - d.r.Len()
+	for pos := start; pos < len(body); pos++ {
+		for _, value := range []byte{0x7f, 0xff} {
+			broken := bytes.Clone(body)
+			broken[pos] = value
+			d := newDecoder(broken[start:])
+			var before, after runtime.MemStats
+			runtime.ReadMemStats(&before)
+			_, _ = readIndex(d)
+			runtime.ReadMemStats(&after)
+			if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+				t.Fatalf("byte %d set to %#x allocated %d bytes", pos, value, allocated)
+			}
+		}
+	}
+}
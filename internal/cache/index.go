@@ -0,0 +1,362 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/HoskeOwl/PoorBookExtractor/internal/entities"
+	"github.com/HoskeOwl/PoorBookExtractor/internal/sources/inp"
+	"github.com/HoskeOwl/PoorBookExtractor/internal/sources/inpx"
+	"github.com/HoskeOwl/PoorBookExtractor/internal/storage"
+	"github.com/adrg/xdg"
+)
+
+/*
+Index cache keeps parsed catalogs in binary files, one per inpx path:
+header (format version and the key of the catalog), then the index itself (see codec.go).
+A cached index is used when the inpx has the same size and mtime and was parsed with the same parser options.
+The content hash is checked only when size or mtime differ, e.g. the catalog was copied over with the same content.
+*/
+
+// formatVersion must be increased on every change of the stored format.
+const formatVersion = 3
+
+const magic = "PBEIDX"
+
+const (
+	appDir   = "PoorBookExtractor"
+	indexDir = "index"
+	indexExt = ".idx"
+)
+
+var (
+	ErrMiss = errors.New("index is not cached")
+	// ErrChanged is returned by Save when the catalog has changed since it was parsed
+	ErrChanged = errors.New("catalog changed while caching")
+)
+
+// Key identifies the parsed state of the catalog.
+type Key struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+	Hash    string
+	Options string
+}
+
+// Index is everything needed to restore a loaded catalog without parsing.
+type Index struct {
+	Library entities.Library
+	Books   []entities.Book
+	Authors []storage.AuthorIndex
+	Report  *inpx.ParseReport
+}
+
+type header struct {
+	Version int
+	Key     Key
+}
+
+type storedRejected struct {
+	Member string
+	Line   int
+	Reason string
+	Raw    string
+}
+
+type storedMemberError struct {
+	Member string
+	Err    string
+}
+
+// storedReport is ParseReport without error values, they can't be stored by gob.
+type storedReport struct {
+	Books           int
+	Rejected        []storedRejected
+	Failed          []storedMemberError
+	Collisions      []inp.Collision
+	MissingArchives []inpx.MissingArchive
+	Encodings       map[string]inp.Encoding
+}
+
+type Cache struct {
+	dir string
+}
+
+func New(dir string) *Cache {
+	return &Cache{dir: dir}
+}
+
+// NewDefault keeps indexes in the XDG cache directory.
+func NewDefault() *Cache {
+	return New(filepath.Join(xdg.CacheHome, appDir, indexDir))
+}
+
+// file is named by the hash of the path, so every catalog has one index.
+func (c *Cache) file(path string) string {
+	sum := sha256.Sum256([]byte(path))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+indexExt)
+}
+
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err = io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// NewKey describes the current state of the catalog without the content hash, Save calculates it.
+func NewKey(path, options string) (Key, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return Key{}, err
+	}
+	stat, err := os.Stat(path)
+	if err != nil {
+		return Key{}, err
+	}
+	return Key{Path: path, Size: stat.Size(), ModTime: stat.ModTime().UTC(), Options: options}, nil
+}
+
+// sameCatalog reports whether keys are of one catalog parsed with the same options.
+func (k Key) sameCatalog(other Key) bool {
+	return k.Path == other.Path && k.Options == other.Options
+}
+
+func (k Key) sameStat(other Key) bool {
+	return k.sameCatalog(other) && k.Size == other.Size && k.ModTime.Equal(other.ModTime)
+}
+
+/*
+Load returns the cached index of the catalog and its key.
+ErrMiss is returned when there is no index or it is outdated or corrupted, such an index is removed.
+*/
+func (c *Cache) Load(path, options string) (*Index, Key, error) {
+	key, err := NewKey(path, options)
+	if err != nil {
+		return nil, Key{}, err
+	}
+	data, err := os.ReadFile(c.file(key.Path))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, key, ErrMiss
+	}
+	if err != nil {
+		return nil, key, err
+	}
+	body, ok := checkSum(data)
+	if !ok {
+		c.drop(key.Path)
+		return nil, key, fmt.Errorf("%w: %w", ErrMiss, errCorrupted)
+	}
+	d := newDecoder(body)
+	prefix := make([]byte, len(magic))
+	_, d.err = io.ReadFull(d.r, prefix)
+	var head header
+	d.blob(&head)
+	if d.err != nil || string(prefix) != magic || head.Version != formatVersion || !head.Key.sameCatalog(key) {
+		c.drop(key.Path)
+		return nil, key, ErrMiss
+	}
+	if !head.Key.sameStat(key) {
+		if key.Hash, err = hashFile(key.Path); err != nil {
+			return nil, key, err
+		}
+		if key.Hash != head.Key.Hash {
+			c.drop(key.Path)
+			return nil, key, ErrMiss
+		}
+	}
+	key.Hash = head.Key.Hash
+	index, err := readIndex(d)
+	if err != nil {
+		c.drop(key.Path)
+		return nil, key, fmt.Errorf("%w: %w", ErrMiss, err)
+	}
+	return index, key, nil
+}
+
+// drop removes the outdated or broken index.
+func (c *Cache) drop(path string) {
+	os.Remove(c.file(path))
+}
+
+// checkSum returns the index without its trailing checksum and reports whether the checksum matches.
+func checkSum(data []byte) ([]byte, bool) {
+	if len(data) < crc32.Size {
+		return nil, false
+	}
+	body := data[:len(data)-crc32.Size]
+	return body, crc32.ChecksumIEEE(body) == binary.BigEndian.Uint32(data[len(body):])
+}
+
+func readIndex(d *decoder) (*Index, error) {
+	index := &Index{}
+	var report storedReport
+	d.blob(&index.Library)
+	d.blob(&report)
+	count := d.count(1<<31, 1)
+	d.strings = make([]string, 0, count)
+	for range count {
+		d.strings = append(d.strings, string(d.bytes()))
+	}
+	index.Books = make([]entities.Book, d.count(1<<31, minBookSize))
+	for idx := range index.Books {
+		d.book(&index.Books[idx])
+	}
+	index.Authors = d.authors(len(index.Books))
+	if d.err == nil && d.remaining() != 0 {
+		d.err = fmt.Errorf("%w: %d bytes after the index", errCorrupted, d.remaining())
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	index.Report = restoreReport(report)
+	return index, nil
+}
+
+/*
+writeIndex writes books first into memory, because the table of strings
+collected while writing them has to precede them in the file.
+*/
+func writeIndex(out io.Writer, key Key, index *Index) error {
+	sum := crc32.NewIEEE()
+	w := bufio.NewWriter(io.MultiWriter(out, sum))
+	table := newStringTable()
+	var body bytes.Buffer
+	bodyWriter := bufio.NewWriter(&body)
+	be := &encoder{w: bodyWriter}
+	be.uvarint(uint64(len(index.Books)))
+	for idx := range index.Books {
+		be.book(table, &index.Books[idx])
+	}
+	be.authors(table, index.Authors)
+	if be.err == nil {
+		be.err = bodyWriter.Flush()
+	}
+	if be.err != nil {
+		return be.err
+	}
+
+	e := &encoder{w: w}
+	_, e.err = w.WriteString(magic)
+	e.blob(header{Version: formatVersion, Key: key})
+	e.blob(index.Library)
+	e.blob(storeReport(index.Report))
+	e.uvarint(uint64(len(table.strings)))
+	for _, value := range table.strings {
+		e.bytes([]byte(value))
+	}
+	if e.err != nil {
+		return e.err
+	}
+	if _, err := body.WriteTo(w); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	_, err := out.Write(sum.Sum(nil))
+	return err
+}
+
+/*
+Save stores the index, it is written to a temporary file first so a broken write never replaces a good index.
+The content hash is calculated here, so Save is meant to run in background.
+The index is not stored when the catalog has changed since the key was taken.
+*/
+func (c *Cache) Save(key Key, index *Index) error {
+	var err error
+	if key.Hash, err = hashFile(key.Path); err != nil {
+		return err
+	}
+	current, err := NewKey(key.Path, key.Options)
+	if err != nil {
+		return err
+	}
+	if !current.sameStat(key) {
+		return fmt.Errorf("%w: %s", ErrChanged, key.Path)
+	}
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(c.dir, "*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	err = writeIndex(file, key, index)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), c.file(key.Path))
+}
+
+// Remove drops the index of the catalog, a missing index is not an error.
+func (c *Cache) Remove(path string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(c.file(path))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func storeReport(report *inpx.ParseReport) storedReport {
+	if report == nil {
+		return storedReport{}
+	}
+	stored := storedReport{
+		Books:           report.Books,
+		Collisions:      report.Collisions,
+		MissingArchives: report.MissingArchives,
+		Encodings:       report.Encodings,
+	}
+	for _, rejected := range report.Rejected {
+		stored.Rejected = append(stored.Rejected, storedRejected{Member: rejected.Member, Line: rejected.Line, Reason: rejected.Reason(), Raw: rejected.Raw})
+	}
+	for _, failed := range report.Failed {
+		stored.Failed = append(stored.Failed, storedMemberError{Member: failed.Member, Err: failed.Err.Error()})
+	}
+	return stored
+}
+
+func restoreReport(stored storedReport) *inpx.ParseReport {
+	report := &inpx.ParseReport{
+		Books:           stored.Books,
+		Collisions:      stored.Collisions,
+		MissingArchives: stored.MissingArchives,
+		Encodings:       stored.Encodings,
+	}
+	if report.Encodings == nil {
+		report.Encodings = make(map[string]inp.Encoding)
+	}
+	for _, rejected := range stored.Rejected {
+		report.Rejected = append(report.Rejected, inpx.Rejected{Member: rejected.Member, Line: rejected.Line, Kind: inp.KindByReason(rejected.Reason), Raw: rejected.Raw})
+	}
+	for _, failed := range stored.Failed {
+		report.Failed = append(report.Failed, inpx.MemberError{Member: failed.Member, Err: errors.New(failed.Err)})
+	}
+	return report
+}
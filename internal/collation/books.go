@@ -0,0 +1,103 @@
+package collation
+
+import (
+	"bytes"
+	"cmp"
+	"slices"
+
+	"github.com/HoskeOwl/PoorBookExtractor/internal/entities"
+)
+
+// bookKeys keeps everything books are compared by, so nothing is computed during sorting.
+type bookKeys struct {
+	title    []byte
+	series   []byte
+	inSeries bool
+	number   float64
+	numbered bool
+	key      string
+	book     *entities.Book
+}
+
+func (c *Collator) bookKeys(books []*entities.Book) []bookKeys {
+	keys := make([]bookKeys, len(books))
+	// books of one series are usually sorted together
+	series := make(map[string][]byte)
+	for i, book := range books {
+		// names of one series may differ in case
+		name := book.SeriesKey()
+		seriesKey, ok := series[name]
+		if !ok {
+			seriesKey = c.Key(name)
+			series[name] = seriesKey
+		}
+		number, numbered := book.SeriesIndex()
+		keys[i] = bookKeys{title: c.Key(book.Title), series: seriesKey, inSeries: name != "", number: number, numbered: numbered, key: book.Key(), book: book}
+	}
+	return keys
+}
+
+// compareNumbers orders books by number in series (see entities.Book.SeriesIndex), books without number go last.
+func compareNumbers(a, b bookKeys) int {
+	switch {
+	case a.numbered && !b.numbered:
+		return -1
+	case !a.numbered && b.numbered:
+		return 1
+	case a.numbered && b.numbered:
+		return cmp.Compare(a.number, b.number)
+	}
+	return 0
+}
+
+func compareBookKeys(a, b bookKeys) int {
+	return cmp.Or(
+		bytes.Compare(a.title, b.title),
+		bytes.Compare(a.series, b.series),
+		compareNumbers(a, b),
+		a.book.Date.Compare(b.book.Date),
+		cmp.Compare(a.key, b.key),
+	)
+}
+
+func sortBookKeys(books []*entities.Book, keys []bookKeys, compare func(a, b bookKeys) int) {
+	slices.SortFunc(keys, compare)
+	for i := range keys {
+		books[i] = keys[i].book
+	}
+}
+
+// compareOrder returns the comparison of books by the order, equal ones are compared by compareBookKeys.
+func compareOrder(order entities.BookOrder) func(a, b bookKeys) int {
+	switch order {
+	case entities.ByTitle:
+		return compareBookKeys
+	case entities.ByNewest:
+		return func(a, b bookKeys) int {
+			return cmp.Or(b.book.Date.Compare(a.book.Date), compareBookKeys(a, b))
+		}
+	case entities.BySize:
+		return func(a, b bookKeys) int {
+			return cmp.Or(cmp.Compare(b.book.Size, a.book.Size), compareBookKeys(a, b))
+		}
+	case entities.ByRating:
+		return func(a, b bookKeys) int {
+			return cmp.Or(b.book.Rating-a.book.Rating, compareBookKeys(a, b))
+		}
+	default:
+		return func(a, b bookKeys) int {
+			if a.inSeries != b.inSeries {
+				if a.inSeries {
+					return -1
+				}
+				return 1
+			}
+			return cmp.Or(bytes.Compare(a.series, b.series), compareNumbers(a, b), compareBookKeys(a, b))
+		}
+	}
+}
+
+// SortBooks orders books by the order, books equal in it go by title, then by series and number in it, then from the oldest.
+func (c *Collator) SortBooks(books []*entities.Book, order entities.BookOrder) {
+	sortBookKeys(books, c.bookKeys(books), compareOrder(order))
+}
@@ -0,0 +1,141 @@
+/*
+Package collation orders names and titles by the Unicode collation of the chosen locale instead of byte order,
+so "Ёжик" goes next to "Ежевика", "Élan" next to "Elk" and "Title 9" before "Title 10".
+*/
+package collation
+
+import (
+	"bytes"
+	"cmp"
+	"slices"
+	"sync"
+	"unicode"
+
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+type Locale string
+
+const (
+	English   Locale = "en"
+	Russian   Locale = "ru"
+	Ukrainian Locale = "uk"
+)
+
+var Locales = []Locale{English, Russian, Ukrainian}
+
+func (l Locale) String() string {
+	switch l {
+	case Russian:
+		return "Russian"
+	case Ukrainian:
+		return "Ukrainian"
+	default:
+		return "English"
+	}
+}
+
+// ParseLocale returns the locale by code, English for unknown ones.
+func ParseLocale(code string) Locale {
+	for _, locale := range Locales {
+		if string(locale) == code {
+			return locale
+		}
+	}
+	return English
+}
+
+// script returns the table the locale lists first, text in other scripts goes after it.
+func (l Locale) script() *unicode.RangeTable {
+	if l == Russian || l == Ukrainian {
+		return unicode.Cyrillic
+	}
+	return unicode.Latin
+}
+
+/*
+Collator compares strings by the rules of the locale, it is safe for concurrent use.
+Texts starting with a letter of the locale script go before texts in other scripts,
+golang.org/x/text/collate doesn't reorder scripts by itself.
+*/
+type Collator struct {
+	locale Locale
+	mu     sync.Mutex
+	c      *collate.Collator
+	buf    collate.Buffer
+}
+
+func New(locale Locale) *Collator {
+	return &Collator{locale: locale, c: collate.New(language.Make(string(locale)), collate.Numeric)}
+}
+
+func (c *Collator) Locale() Locale {
+	return c.locale
+}
+
+// group is the position of the text among scripts: digits and punctuation, the locale script, other scripts.
+func (c *Collator) group(text string) int {
+	for _, r := range text {
+		switch {
+		case !unicode.IsLetter(r):
+			if unicode.IsDigit(r) {
+				return 0
+			}
+			continue
+		case unicode.Is(c.locale.script(), r):
+			return 1
+		default:
+			return 2
+		}
+	}
+	return 0
+}
+
+func (c *Collator) Compare(a, b string) int {
+	if ga, gb := c.group(a), c.group(b); ga != gb {
+		return ga - gb
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.c.CompareString(a, b)
+}
+
+// Key returns the sort key of the text, keys compare with bytes.Compare as the texts with Compare.
+func (c *Collator) Key(text string) []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := c.c.KeyFromString(&c.buf, text)
+	sortKey := make([]byte, 0, len(key)+1)
+	sortKey = append(sortKey, byte(c.group(text)))
+	sortKey = append(sortKey, key...)
+	c.buf.Reset()
+	return sortKey
+}
+
+// Sort sorts the strings in place.
+func (c *Collator) Sort(texts []string) {
+	SortFunc(c, texts, func(text string) string { return text })
+}
+
+/*
+SortFunc sorts items by texts returned by key, items with equal texts keep their order.
+Sort keys are computed once per item, it is much faster than sorting with Compare.
+*/
+func SortFunc[T any](c *Collator, items []T, key func(T) string) {
+	type keyed struct {
+		key   []byte
+		index int
+		item  T
+	}
+	sorted := make([]keyed, len(items))
+	for i, item := range items {
+		sorted[i] = keyed{key: c.Key(key(item)), index: i, item: item}
+	}
+	slices.SortFunc(sorted, func(a, b keyed) int {
+		return cmp.Or(bytes.Compare(a.key, b.key), a.index-b.index)
+	})
+	for i := range sorted {
+		items[i] = sorted[i].item
+	}
+}
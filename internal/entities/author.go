@@ -0,0 +1,109 @@
+package entities
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+type NameFormat int
+
+const (
+	// LastFirstMiddle is "Last First Middle"
+	LastFirstMiddle NameFormat = iota
+	// LastInitials is "Last F. M."
+	LastInitials
+	// FirstMiddleLast is "First Middle Last"
+	FirstMiddleLast
+)
+
+var NameFormats = []NameFormat{LastFirstMiddle, LastInitials, FirstMiddleLast}
+
+func (f NameFormat) String() string {
+	switch f {
+	case LastInitials:
+		return "Last F. M."
+	case FirstMiddleLast:
+		return "First Middle Last"
+	default:
+		return "Last First Middle"
+	}
+}
+
+// Author is a name from inp record in form Last,First,Middle
+type Author struct {
+	Last   string
+	First  string
+	Middle string
+}
+
+func ParseAuthor(raw string) Author {
+	parts := strings.Split(raw, ",")
+	for idx, part := range parts {
+		parts[idx] = strings.TrimSpace(part)
+	}
+	author := Author{Last: parts[0]}
+	if len(parts) > 1 {
+		author.First = parts[1]
+	}
+	if len(parts) > 2 {
+		author.Middle = strings.TrimSpace(strings.Join(parts[2:], " "))
+	}
+	return author
+}
+
+func (a Author) IsEmpty() bool {
+	return a.Last == "" && a.First == "" && a.Middle == ""
+}
+
+func (a Author) Parts() []string {
+	parts := make([]string, 0, 3)
+	for _, part := range []string{a.Last, a.First, a.Middle} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+// Key is the canonical author identifier, the same person written in different case gets the same key.
+func (a Author) Key() string {
+	return strings.ToLower(a.Raw())
+}
+
+// Raw returns the author in inp form.
+func (a Author) Raw() string {
+	return strings.TrimRight(a.Last+","+a.First+","+a.Middle, ",")
+}
+
+func initial(name string) string {
+	if name == "" {
+		return ""
+	}
+	r, _ := utf8.DecodeRuneInString(name)
+	return string(r) + "."
+}
+
+func joinNonEmpty(parts ...string) string {
+	nonEmpty := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part != "" {
+			nonEmpty = append(nonEmpty, part)
+		}
+	}
+	return strings.Join(nonEmpty, " ")
+}
+
+func (a Author) Format(format NameFormat) string {
+	switch format {
+	case LastInitials:
+		return joinNonEmpty(a.Last, initial(a.First), initial(a.Middle))
+	case FirstMiddleLast:
+		return joinNonEmpty(a.First, a.Middle, a.Last)
+	default:
+		return joinNonEmpty(a.Last, a.First, a.Middle)
+	}
+}
+
+func (a Author) String() string {
+	return a.Format(LastFirstMiddle)
+}
@@ -2,6 +2,8 @@ package entities
 
 import (
 	"fmt"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -12,8 +14,10 @@ type BookMetadata struct {
 }
 
 type Book struct {
-	Metadata     BookMetadata
-	Authors      []string
+	Metadata BookMetadata
+	// Source is the id of the loaded library the book comes from
+	Source       string
+	Authors      []Author
 	Genres       []string
 	Title        string
 	Series       string
@@ -21,10 +25,16 @@ type Book struct {
 	Filename     string
 	Size         int64
 	LibID        string
+	Deleted      bool
 	Ext          string
 	Date         time.Time
 	Lang         string
+	Rating       int
 	Keywords     []string
+	// Folder is the FOLDER column, some catalogs list the archive of every book in it
+	Folder string
+	// Duplicate tells apart books of one library repeating the LibID (see inp.KeepBoth), it is empty for the first of them
+	Duplicate string
 
 	fullName string
 }
@@ -36,14 +46,80 @@ func (b *Book) FullName() string {
 	return b.fullName
 }
 
+// Equal compares catalog data of books.
+func (b *Book) Equal(other *Book) bool {
+	return b.Metadata == other.Metadata &&
+		b.Source == other.Source &&
+		slices.Equal(b.Authors, other.Authors) &&
+		slices.Equal(b.Genres, other.Genres) &&
+		b.Title == other.Title &&
+		b.Series == other.Series &&
+		b.SeriesNumber == other.SeriesNumber &&
+		b.Filename == other.Filename &&
+		b.Size == other.Size &&
+		b.LibID == other.LibID &&
+		b.Deleted == other.Deleted &&
+		b.Ext == other.Ext &&
+		b.Date.Equal(other.Date) &&
+		b.Lang == other.Lang &&
+		b.Rating == other.Rating &&
+		slices.Equal(b.Keywords, other.Keywords) &&
+		b.Folder == other.Folder &&
+		b.Duplicate == other.Duplicate
+}
+
+// Key identifies the book among all loaded libraries, LibID is unique only inside one library.
+// Duplicates of a LibID kept in one library get it with the Duplicate suffix.
+func (b *Book) Key() string {
+	key := BookKey(b.Source, b.LibID)
+	if b.Duplicate != "" {
+		key += "@" + b.Duplicate
+	}
+	return key
+}
+
+// SeriesKey identifies the series, the same series written in different case gets the same key.
+// It is empty for books out of series.
+func (b *Book) SeriesKey() string {
+	return strings.ToLower(strings.TrimSpace(b.Series))
+}
+
+// SeriesIndex parses the leading number of SeriesNumber, so "10" goes after "9" and "2.5" between "2" and "3".
+func (b *Book) SeriesIndex() (float64, bool) {
+	number := strings.TrimSpace(b.SeriesNumber)
+	end, dot := 0, false
+	for end < len(number) {
+		c := number[end]
+		if c == '.' || c == ',' {
+			if dot || end == 0 {
+				break
+			}
+			dot = true
+		} else if c < '0' || c > '9' {
+			break
+		}
+		end++
+	}
+	index, err := strconv.ParseFloat(strings.Replace(strings.TrimRight(number[:end], ".,"), ",", ".", 1), 64)
+	return index, err == nil
+}
+
+func BookKey(source, libID string) string {
+	if source == "" {
+		return libID
+	}
+	return source + "#" + libID
+}
+
 func (b *Book) ExtendId(additional string) string {
-	return fmt.Sprintf("%s:%s", additional, b.LibID)
+	return fmt.Sprintf("%s:%s", additional, b.Key())
 }
 
+// GetBookIdFromExtended returns the book key from ExtendId, the additional part may contain ":" itself, e.g. a series name.
 func GetBookIdFromExtended(extended string) string {
-	parts := strings.Split(extended, ":")
-	if len(parts) != 2 {
+	idx := strings.LastIndex(extended, ":")
+	if idx < 0 {
 		return extended
 	}
-	return parts[1]
+	return extended[idx+1:]
 }
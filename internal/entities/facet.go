@@ -0,0 +1,45 @@
+package entities
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Facet is a book property the catalog can be browsed by.
+type Facet int
+
+const (
+	GenreFacet Facet = iota
+	LangFacet
+	YearFacet
+)
+
+var Facets = []Facet{GenreFacet, LangFacet, YearFacet}
+
+func (f Facet) String() string {
+	switch f {
+	case LangFacet:
+		return "language"
+	case YearFacet:
+		return "year"
+	default:
+		return "genre"
+	}
+}
+
+// Values returns values of the facet for the book: genre codes, the lower case language or the year of Date.
+func (f Facet) Values(book *Book) []string {
+	switch f {
+	case LangFacet:
+		if lang := strings.ToLower(strings.TrimSpace(book.Lang)); lang != "" {
+			return []string{lang}
+		}
+	case YearFacet:
+		if !book.Date.IsZero() {
+			return []string{strconv.Itoa(book.Date.Year())}
+		}
+	default:
+		return book.Genres
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package entities
+
+import "slices"
+
+// BookFilter narrows the books shown in the author tree, zero value accepts everything.
+type BookFilter struct {
+	MinRating int
+	// Source limits books to one loaded library, empty means all of them
+	Source string
+	// Genres, Langs and Years are ticked facet values (see Facet.Values), a book needs any of the values of each facet
+	Genres []string
+	Langs  []string
+	Years  []string
+}
+
+func (f BookFilter) Accept(book *Book) bool {
+	if f.MinRating > 0 && book.Rating < f.MinRating {
+		return false
+	}
+	if f.Source != "" && book.Source != f.Source {
+		return false
+	}
+	for _, facet := range Facets {
+		selected := f.Selected(facet)
+		if len(selected) == 0 {
+			continue
+		}
+		if !slices.ContainsFunc(facet.Values(book), func(value string) bool {
+			return slices.Contains(selected, value)
+		}) {
+			return false
+		}
+	}
+	return true
+}
+
+func (f BookFilter) IsEmpty() bool {
+	return f.MinRating == 0 && f.Source == "" && len(f.Genres) == 0 && len(f.Langs) == 0 && len(f.Years) == 0
+}
+
+// Selected returns ticked values of the facet.
+func (f BookFilter) Selected(facet Facet) []string {
+	switch facet {
+	case LangFacet:
+		return f.Langs
+	case YearFacet:
+		return f.Years
+	default:
+		return f.Genres
+	}
+}
+
+// Select returns the filter with the values of the facet replaced.
+func (f BookFilter) Select(facet Facet, values []string) BookFilter {
+	switch facet {
+	case LangFacet:
+		f.Langs = values
+	case YearFacet:
+		f.Years = values
+	default:
+		f.Genres = values
+	}
+	return f
+}
@@ -0,0 +1,30 @@
+package entities
+
+import (
+	"fmt"
+	"time"
+)
+
+// Library describes the collection from collection.info and version.info of inpx.
+type Library struct {
+	Name        string
+	ID          string
+	Type        string
+	Description string
+	URL         string
+	Version     string
+	Date        time.Time
+	// Genres are catalog-specific genre names by codes
+	Genres map[string]string
+}
+
+func (l Library) Title() string {
+	switch {
+	case l.Name == "":
+		return ""
+	case l.Version == "":
+		return l.Name
+	default:
+		return fmt.Sprintf("%s (%s)", l.Name, l.Version)
+	}
+}
@@ -0,0 +1,43 @@
+package entities
+
+// BookOrder is the order of books of an author or a series, see collation.Collator.SortBooks.
+type BookOrder int
+
+const (
+	// BySeries groups books by series ordered by number in them, books out of series go last
+	BySeries BookOrder = iota
+	ByTitle
+	// ByNewest is from the latest added to the catalog
+	ByNewest
+	// BySize is from the largest file
+	BySize
+	// ByRating is from the highest rating
+	ByRating
+)
+
+var BookOrders = []BookOrder{BySeries, ByTitle, ByNewest, BySize, ByRating}
+
+func (o BookOrder) String() string {
+	switch o {
+	case ByTitle:
+		return "title"
+	case ByNewest:
+		return "newest"
+	case BySize:
+		return "size"
+	case ByRating:
+		return "rating"
+	default:
+		return "series"
+	}
+}
+
+// ParseBookOrder returns the order by its String, BySeries for unknown values.
+func ParseBookOrder(value string) BookOrder {
+	for _, order := range BookOrders {
+		if order.String() == value {
+			return order
+		}
+	}
+	return BySeries
+}
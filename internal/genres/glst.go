@@ -0,0 +1,55 @@
+package genres
+
+import (
+	"bufio"
+	"bytes"
+	"maps"
+	"slices"
+	"strings"
+)
+
+/*
+glst is the genre list format of MyHomeLib, catalogs may ship their own one:
+0.1 Фантастика
+0.1.1 sf_history;Альтернативная история
+Category lines have no code and are skipped.
+*/
+
+func isOrderNumber(value string) bool {
+	return strings.Trim(value, "0123456789.") == ""
+}
+
+// ParseGlst returns genre names by codes from the glst file.
+func ParseGlst(data []byte) map[string]string {
+	names := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if number, rest, ok := strings.Cut(line, " "); ok && isOrderNumber(number) {
+			line = strings.TrimSpace(rest)
+		}
+		code, name, ok := strings.Cut(line, ";")
+		if !ok {
+			continue
+		}
+		code = strings.TrimSpace(code)
+		name = strings.TrimSpace(name)
+		if code == "" || name == "" {
+			continue
+		}
+		names[code] = name
+	}
+	return names
+}
+
+// FormatGlst writes genre names in the glst form without category lines.
+func FormatGlst(names map[string]string) []byte {
+	var buf bytes.Buffer
+	for _, code := range slices.Sorted(maps.Keys(names)) {
+		buf.WriteString(code + ";" + names[code] + "\r\n")
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,166 @@
+package genres
+
+import (
+	"bufio"
+	"bytes"
+	_ "embed"
+	"strings"
+	"unicode"
+)
+
+//go:embed genres.txt
+var standard []byte
+
+type Lang string
+
+const (
+	English Lang = "en"
+	Russian Lang = "ru"
+)
+
+var Langs = []Lang{English, Russian}
+
+// Category groups genres, e.g. all kinds of science fiction.
+type Category struct {
+	ID    string
+	Names map[Lang]string
+}
+
+type Genre struct {
+	Code     string
+	Category string
+	Names    map[Lang]string
+}
+
+// Registry maps FB2 genre codes to human-readable names.
+type Registry struct {
+	genres     map[string]*Genre
+	categories map[string]*Category
+	// order are category IDs in the order of the standard list
+	order []string
+}
+
+func NewRegistry() *Registry {
+	registry := &Registry{
+		genres:     make(map[string]*Genre),
+		categories: make(map[string]*Category),
+	}
+	registry.load(standard)
+	return registry
+}
+
+func (r *Registry) load(data []byte) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	category := ""
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.Split(line, ";")
+		if len(parts) != 3 {
+			continue
+		}
+		names := map[Lang]string{English: parts[1], Russian: parts[2]}
+		if id, ok := strings.CutPrefix(parts[0], "@"); ok {
+			category = id
+			if _, ok := r.categories[id]; !ok {
+				r.order = append(r.order, id)
+			}
+			r.categories[id] = &Category{ID: id, Names: names}
+			continue
+		}
+		r.genres[parts[0]] = &Genre{Code: parts[0], Category: category, Names: names}
+	}
+}
+
+func detectLang(name string) Lang {
+	for _, r := range name {
+		if unicode.Is(unicode.Cyrillic, r) {
+			return Russian
+		}
+	}
+	return English
+}
+
+/*
+Override applies a catalog-specific genre list (code -> name).
+The name replaces the standard one for the language it is written in,
+codes unknown to the standard list get the name for all languages.
+*/
+func (r *Registry) Override(names map[string]string) {
+	for code, name := range names {
+		genre, ok := r.genres[code]
+		if !ok {
+			genre = &Genre{Code: code, Names: make(map[Lang]string)}
+			for _, lang := range Langs {
+				genre.Names[lang] = name
+			}
+			r.genres[code] = genre
+			continue
+		}
+		genre.Names[detectLang(name)] = name
+	}
+}
+
+// Name returns the genre name or the code itself when the genre is unknown.
+func (r *Registry) Name(code string, lang Lang) string {
+	genre, ok := r.genres[code]
+	if !ok {
+		return code
+	}
+	if name := genre.Names[lang]; name != "" {
+		return name
+	}
+	return code
+}
+
+func (r *Registry) Names(codes []string, lang Lang) []string {
+	names := make([]string, 0, len(codes))
+	for _, code := range codes {
+		names = append(names, r.Name(code, lang))
+	}
+	return names
+}
+
+// CategoryName returns the name of the category the genre belongs to or empty string.
+func (r *Registry) CategoryName(code string, lang Lang) string {
+	genre, ok := r.genres[code]
+	if !ok {
+		return ""
+	}
+	category, ok := r.categories[genre.Category]
+	if !ok {
+		return ""
+	}
+	return category.Names[lang]
+}
+
+// Group is genres of one category, Name is empty for genres out of the standard categories.
+type Group struct {
+	Name  string
+	Codes []string
+}
+
+// Group splits codes by categories, categories go in the order of the standard list and genres keep their order.
+// Codes without a category are the last group.
+func (r *Registry) Group(codes []string, lang Lang) []Group {
+	byCategory := make(map[string][]string)
+	for _, code := range codes {
+		category := ""
+		if genre, ok := r.genres[code]; ok {
+			category = genre.Category
+		}
+		byCategory[category] = append(byCategory[category], code)
+	}
+	groups := make([]Group, 0, len(byCategory))
+	for _, id := range r.order {
+		if codes, ok := byCategory[id]; ok {
+			groups = append(groups, Group{Name: r.CategoryName(codes[0], lang), Codes: codes})
+		}
+	}
+	if codes, ok := byCategory[""]; ok {
+		groups = append(groups, Group{Codes: codes})
+	}
+	return groups
+}
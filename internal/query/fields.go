@@ -0,0 +1,420 @@
+package query
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/HoskeOwl/PoorBookExtractor/internal/entities"
+	"github.com/HoskeOwl/PoorBookExtractor/internal/search"
+)
+
+// Field names a book field in queries.
+type Field string
+
+const (
+	FieldAuthor   Field = "author"
+	FieldTitle    Field = "title"
+	FieldSeries   Field = "series"
+	FieldSerNo    Field = "serno"
+	FieldGenre    Field = "genre"
+	FieldFile     Field = "file"
+	FieldSize     Field = "size"
+	FieldLibID    Field = "libid"
+	FieldDeleted  Field = "deleted"
+	FieldExt      Field = "ext"
+	FieldDate     Field = "date"
+	FieldLang     Field = "lang"
+	FieldRating   Field = "rating"
+	FieldKeywords Field = "keywords"
+	FieldFolder   Field = "folder"
+	FieldArchive  Field = "archive"
+	FieldSource   Field = "source"
+)
+
+var Fields = []Field{
+	FieldAuthor, FieldTitle, FieldSeries, FieldSerNo, FieldGenre, FieldFile, FieldSize, FieldLibID, FieldDeleted,
+	FieldExt, FieldDate, FieldLang, FieldRating, FieldKeywords, FieldFolder, FieldArchive, FieldSource,
+}
+
+var fieldAliases = map[string]Field{
+	"del":     FieldDeleted,
+	"librate": FieldRating,
+	"kw":      FieldKeywords,
+	"keyword": FieldKeywords,
+	"year":    FieldDate,
+	"library": FieldSource,
+}
+
+// ParseField accepts field names and their aliases in any case.
+func ParseField(name string) (Field, bool) {
+	name = strings.ToLower(name)
+	for _, field := range Fields {
+		if string(field) == name {
+			return field, true
+		}
+	}
+	field, ok := fieldAliases[name]
+	return field, ok
+}
+
+// texts returns values of text fields, a book matches if any of them matches.
+func texts(field Field, book *entities.Book) []string {
+	switch field {
+	case FieldAuthor:
+		names := make([]string, 0, len(book.Authors))
+		for _, author := range book.Authors {
+			names = append(names, author.String())
+		}
+		return names
+	case FieldTitle:
+		return []string{book.Title}
+	case FieldSeries:
+		return []string{book.Series}
+	case FieldSerNo:
+		return []string{book.SeriesNumber}
+	case FieldGenre:
+		return book.Genres
+	case FieldFile:
+		return []string{book.Filename}
+	case FieldSize:
+		return []string{strconv.FormatInt(book.Size, 10)}
+	case FieldLibID:
+		return []string{book.LibID}
+	case FieldExt:
+		return []string{book.Ext}
+	case FieldLang:
+		return []string{book.Lang}
+	case FieldRating:
+		return []string{strconv.Itoa(book.Rating)}
+	case FieldKeywords:
+		return book.Keywords
+	case FieldFolder:
+		return []string{book.Folder}
+	case FieldArchive:
+		return []string{book.Metadata.ArchiveName}
+	case FieldSource:
+		return []string{book.Source}
+	}
+	return nil
+}
+
+// anyText are fields searched by words without a field
+var anyText = []Field{FieldAuthor, FieldTitle, FieldSeries, FieldKeywords}
+
+func compile(term *Term) (func(book *entities.Book) bool, error) {
+	switch term.Field {
+	case "":
+		matchers := make([]func(book *entities.Book) bool, 0, len(anyText))
+		for _, field := range anyText {
+			matchers = append(matchers, compileText(term, field, true))
+		}
+		return func(book *entities.Book) bool {
+			for _, match := range matchers {
+				if match(book) {
+					return true
+				}
+			}
+			return false
+		}, nil
+	case FieldAuthor, FieldTitle, FieldSeries, FieldFile, FieldKeywords, FieldFolder, FieldArchive:
+		return compileTextOp(term, true)
+	case FieldGenre, FieldExt, FieldLang, FieldSource:
+		return compileTextOp(term, false)
+	case FieldSize:
+		return compileNumber(term, parseSize, func(book *entities.Book) (int64, bool) {
+			return book.Size, true
+		})
+	case FieldRating:
+		return compileNumber(term, parseInt, func(book *entities.Book) (int64, bool) {
+			return int64(book.Rating), true
+		})
+	case FieldSerNo:
+		return compileNumber(term, parseIndex, func(book *entities.Book) (float64, bool) {
+			return book.SeriesIndex()
+		})
+	case FieldLibID:
+		return compileNumber(term, parseInt, func(book *entities.Book) (int64, bool) {
+			number, err := strconv.ParseInt(book.LibID, 10, 64)
+			return number, err == nil
+		})
+	case FieldDate:
+		return compileDate(term)
+	case FieldDeleted:
+		return compileBool(term)
+	}
+	return nil, fmt.Errorf("%w %s", ErrUnknownField, term.Field)
+}
+
+func unsupported(term *Term) error {
+	return fmt.Errorf("%w %s for %s", ErrUnsupportedOperator, term.Op, term.Field)
+}
+
+func compileTextOp(term *Term, contains bool) (func(book *entities.Book) bool, error) {
+	switch term.Op {
+	case Match:
+		return compileText(term, term.Field, contains), nil
+	case Equal:
+		return compileText(term, term.Field, false), nil
+	case NotEqual:
+		match := compileText(term, term.Field, false)
+		return func(book *entities.Book) bool { return !match(book) }, nil
+	}
+	return nil, unsupported(term)
+}
+
+// compileText matches the value of the term as a wildcard pattern, a part of the text or the whole text.
+// An empty value matches books without the field. Authors also match by transliteration, see compileAuthor.
+func compileText(term *Term, field Field, contains bool) func(book *entities.Book) bool {
+	if term.Value == "" {
+		return func(book *entities.Book) bool {
+			for _, text := range texts(field, book) {
+				if text != "" {
+					return false
+				}
+			}
+			return true
+		}
+	}
+	match := textMatcher(fold(term.Value), contains)
+	if field == FieldAuthor {
+		return compileAuthor(term, match, contains)
+	}
+	return func(book *entities.Book) bool {
+		for _, text := range texts(field, book) {
+			if match(fold(text)) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// textMatcher matches folded texts with the folded pattern.
+func textMatcher(pattern string, contains bool) func(text string) bool {
+	switch {
+	case strings.ContainsAny(pattern, "*?"):
+		glob := []rune(pattern)
+		return func(text string) bool { return globMatch(glob, []rune(text)) }
+	case contains:
+		return func(text string) bool { return strings.Contains(text, pattern) }
+	}
+	return func(text string) bool { return text == pattern }
+}
+
+// compileAuthor matches names as written or by transliteration keys like the author search does,
+// so author:strugatsky finds "Стругацкий".
+func compileAuthor(term *Term, match func(text string) bool, contains bool) func(book *entities.Book) bool {
+	pattern := wildcardKey(term.Value)
+	if strings.Trim(pattern, "*? ") == "" {
+		pattern = ""
+	}
+	matchKey := textMatcher(pattern, contains)
+	return func(book *entities.Book) bool {
+		for _, author := range book.Authors {
+			if match(fold(author.String())) || pattern != "" && matchKey(term.nameKey(author)) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// wildcardKey transliterates parts of the pattern between wildcards.
+func wildcardKey(value string) string {
+	var b strings.Builder
+	start := 0
+	for idx, r := range value {
+		if r == '*' || r == '?' {
+			b.WriteString(search.Key(value[start:idx]))
+			b.WriteRune(r)
+			start = idx + 1
+		}
+	}
+	b.WriteString(search.Key(value[start:]))
+	return b.String()
+}
+
+func compileNumber[T cmp.Ordered](term *Term, parse func(string) (T, error), get func(book *entities.Book) (T, bool)) (func(book *entities.Book) bool, error) {
+	if (term.Op == Match || term.Op == Equal || term.Op == NotEqual) && (term.Value == "" || strings.ContainsAny(term.Value, "*?")) {
+		return compileTextOp(term, false)
+	}
+	value, err := parse(term.Value)
+	if err != nil {
+		return nil, err
+	}
+	var compare func(number T) bool
+	switch term.Op {
+	case Match, Equal:
+		compare = func(number T) bool { return number == value }
+	case NotEqual:
+		compare = func(number T) bool { return number != value }
+	case Less:
+		compare = func(number T) bool { return number < value }
+	case LessOrEqual:
+		compare = func(number T) bool { return number <= value }
+	case Greater:
+		compare = func(number T) bool { return number > value }
+	case GreaterOrEqual:
+		compare = func(number T) bool { return number >= value }
+	}
+	return func(book *entities.Book) bool {
+		number, ok := get(book)
+		return ok && compare(number)
+	}, nil
+}
+
+func parseInt(value string) (int64, error) {
+	number, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w %q, number expected", ErrInvalidValue, value)
+	}
+	return number, nil
+}
+
+// parseIndex accepts numbers in series like 2 or 1.5, books are compared by entities.Book.SeriesIndex.
+func parseIndex(value string) (float64, error) {
+	number, err := strconv.ParseFloat(strings.Replace(value, ",", ".", 1), 64)
+	if err != nil || math.IsNaN(number) || math.IsInf(number, 0) {
+		return 0, fmt.Errorf("%w %q, number like 2 or 1.5 expected", ErrInvalidValue, value)
+	}
+	return number, nil
+}
+
+var sizeUnits = []struct {
+	suffix string
+	factor float64
+}{
+	{"kb", 1 << 10}, {"mb", 1 << 20}, {"gb", 1 << 30},
+	{"k", 1 << 10}, {"m", 1 << 20}, {"g", 1 << 30},
+	{"b", 1},
+}
+
+// parseSize accepts bytes or sizes with B, KB, MB and GB suffixes, e.g. 2MB or 1.5m.
+func parseSize(value string) (int64, error) {
+	number := strings.ToLower(value)
+	factor := 1.0
+	for _, unit := range sizeUnits {
+		if strings.HasSuffix(number, unit.suffix) {
+			number = strings.TrimSuffix(number, unit.suffix)
+			factor = unit.factor
+			break
+		}
+	}
+	size, err := strconv.ParseFloat(number, 64)
+	size *= factor
+	// float64(math.MaxInt64) is rounded up to 1<<63, which overflows int64 already
+	if err != nil || math.IsNaN(size) || size < 0 || size >= math.MaxInt64 {
+		return 0, fmt.Errorf("%w %q, size like 500KB or 2MB expected", ErrInvalidValue, value)
+	}
+	return int64(size), nil
+}
+
+var dateLayouts = []struct {
+	layout string
+	years  int
+	months int
+	days   int
+}{
+	{time.DateOnly, 0, 0, 1},
+	{"2006-01", 0, 1, 0},
+	{"2006", 1, 0, 0},
+}
+
+// parsePeriod returns the period the date denotes: a year, a month or a day.
+func parsePeriod(value string) (time.Time, time.Time, error) {
+	for _, layout := range dateLayouts {
+		start, err := time.Parse(layout.layout, value)
+		if err == nil {
+			return start, start.AddDate(layout.years, layout.months, layout.days), nil
+		}
+	}
+	return time.Time{}, time.Time{}, fmt.Errorf("%w %q, date like 2015, 2015-03 or 2015-03-02 expected", ErrInvalidValue, value)
+}
+
+// compileDate compares dates with periods, e.g. date<=2015 includes the whole 2015 year. Books without date never match.
+func compileDate(term *Term) (func(book *entities.Book) bool, error) {
+	start, end, err := parsePeriod(term.Value)
+	if err != nil {
+		return nil, err
+	}
+	var compare func(date time.Time) bool
+	switch term.Op {
+	case Match, Equal:
+		compare = func(date time.Time) bool { return !date.Before(start) && date.Before(end) }
+	case NotEqual:
+		compare = func(date time.Time) bool { return date.Before(start) || !date.Before(end) }
+	case Less:
+		compare = func(date time.Time) bool { return date.Before(start) }
+	case LessOrEqual:
+		compare = func(date time.Time) bool { return date.Before(end) }
+	case Greater:
+		compare = func(date time.Time) bool { return !date.Before(end) }
+	case GreaterOrEqual:
+		compare = func(date time.Time) bool { return !date.Before(start) }
+	}
+	return func(book *entities.Book) bool {
+		return !book.Date.IsZero() && compare(book.Date)
+	}, nil
+}
+
+func compileBool(term *Term) (func(book *entities.Book) bool, error) {
+	var value bool
+	switch strings.ToLower(term.Value) {
+	case "", "1", "yes", "true":
+		value = true
+	case "0", "no", "false":
+		value = false
+	default:
+		return nil, fmt.Errorf("%w %q, yes or no expected", ErrInvalidValue, term.Value)
+	}
+	switch term.Op {
+	case Match, Equal:
+	case NotEqual:
+		value = !value
+	default:
+		return nil, unsupported(term)
+	}
+	return func(book *entities.Book) bool { return book.Deleted == value }, nil
+}
+
+// fold makes matching case insensitive and treats ё as е.
+func fold(text string) string {
+	return strings.Map(func(r rune) rune {
+		r = unicode.ToLower(r)
+		if r == 'ё' {
+			return 'е'
+		}
+		return r
+	}, text)
+}
+
+// globMatch matches the whole text with the pattern where * is any sequence and ? is any rune.
+func globMatch(pattern, text []rune) bool {
+	star, mark := -1, 0
+	p, t := 0, 0
+	for t < len(text) {
+		switch {
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] == text[t]):
+			p++
+			t++
+		case p < len(pattern) && pattern[p] == '*':
+			star, mark = p, t
+			p++
+		case star >= 0:
+			p = star + 1
+			mark++
+			t = mark
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
@@ -0,0 +1,268 @@
+/*
+Package query parses and evaluates field-qualified catalog queries, e.g.
+
+	author:strugatsky lang:ru date>=2015 size<2MB ext:fb2 genre:sf_* -series:""
+
+Terms separated by spaces must all match, groups of terms separated by "OR" or "|" are alternatives.
+A term is a word or a quoted phrase optionally qualified by a field and an operator,
+"-" before a term negates it. See Field for the list of fields.
+*/
+package query
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/HoskeOwl/PoorBookExtractor/internal/entities"
+	"github.com/HoskeOwl/PoorBookExtractor/internal/search"
+)
+
+var ErrUnknownField = errors.New("unknown field")
+var ErrUnsupportedOperator = errors.New("unsupported operator")
+var ErrInvalidValue = errors.New("invalid value")
+var ErrUnterminatedQuote = errors.New("unterminated quote")
+var ErrEmptyTerm = errors.New("empty term")
+
+// SyntaxError points to the term of the query which can't be parsed.
+type SyntaxError struct {
+	// Pos is the offset of the term in the query in bytes
+	Pos  int
+	Term string
+	Err  error
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("position %d, %q: %s", e.Pos+1, e.Term, e.Err)
+}
+
+func (e *SyntaxError) Unwrap() error {
+	return e.Err
+}
+
+type Operator int
+
+const (
+	// Match is ":", it looks for the value inside text fields and equals for other ones
+	Match Operator = iota
+	Equal
+	NotEqual
+	Less
+	LessOrEqual
+	Greater
+	GreaterOrEqual
+)
+
+// operators are ordered so that two char operators are tried first
+var operators = []Operator{NotEqual, LessOrEqual, GreaterOrEqual, Match, Equal, Less, Greater}
+
+func (o Operator) String() string {
+	switch o {
+	case Equal:
+		return "="
+	case NotEqual:
+		return "!="
+	case Less:
+		return "<"
+	case LessOrEqual:
+		return "<="
+	case Greater:
+		return ">"
+	case GreaterOrEqual:
+		return ">="
+	default:
+		return ":"
+	}
+}
+
+// Term is one condition of the query, Field is empty for words without a field.
+type Term struct {
+	Field   Field
+	Op      Operator
+	Value   string
+	Negated bool
+
+	match func(book *entities.Book) bool
+	// nameKeys gives transliteration keys of author names, see Query.UseNameKeys
+	nameKeys func(author entities.Author) string
+}
+
+func (t *Term) Match(book *entities.Book) bool {
+	return t.match(book) != t.Negated
+}
+
+// nameKey returns the transliteration key of the author name (see search.Key).
+func (t *Term) nameKey(author entities.Author) string {
+	if t.nameKeys != nil {
+		return t.nameKeys(author)
+	}
+	return search.Key(author.String())
+}
+
+// Query is a list of alternative groups of terms.
+type Query struct {
+	Groups [][]*Term
+}
+
+// UseNameKeys makes author terms take transliteration keys of names from the function, so a storage can keep them
+// between queries instead of building them for every book.
+func (q *Query) UseNameKeys(nameKeys func(author entities.Author) string) {
+	for _, group := range q.Groups {
+		for _, term := range group {
+			term.nameKeys = nameKeys
+		}
+	}
+}
+
+// Match checks that all terms of some group match the book, an empty query matches everything.
+func (q *Query) Match(book *entities.Book) bool {
+	if len(q.Groups) == 0 {
+		return true
+	}
+	for _, group := range q.Groups {
+		matched := true
+		for _, term := range group {
+			if !term.Match(book) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+var qualifiedTerm = regexp.MustCompile(`^-?(\pL+)(:|=|!=|<|>)`)
+
+// IsQualified reports whether the text uses known fields or negation, plain text is left to the name and full-text search,
+// so a title like "Foundation: Empire" is not taken for a query.
+func IsQualified(text string) bool {
+	for _, word := range strings.Fields(text) {
+		if len(word) > 1 && word[0] == '-' {
+			return true
+		}
+		if match := qualifiedTerm.FindStringSubmatch(word); match != nil {
+			if _, ok := ParseField(match[1]); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func Parse(text string) (*Query, error) {
+	q := &Query{Groups: make([][]*Term, 0)}
+	group := make([]*Term, 0)
+	runes := []rune(text)
+	pos := 0
+	for {
+		for pos < len(runes) && unicode.IsSpace(runes[pos]) {
+			pos++
+		}
+		if pos >= len(runes) {
+			break
+		}
+		start := pos
+		term, next, err := parseTerm(runes, pos)
+		if err != nil {
+			end := min(next, len(runes))
+			return nil, &SyntaxError{Pos: len(string(runes[:start])), Term: string(runes[start:end]), Err: err}
+		}
+		pos = next
+		if term == nil {
+			// group separator
+			if len(group) > 0 {
+				q.Groups = append(q.Groups, group)
+			}
+			group = make([]*Term, 0)
+			continue
+		}
+		group = append(group, term)
+	}
+	if len(group) > 0 {
+		q.Groups = append(q.Groups, group)
+	}
+	return q, nil
+}
+
+// parseTerm reads the term at pos and returns the position after it, nil term is the "OR" separator.
+func parseTerm(runes []rune, pos int) (*Term, int, error) {
+	end := pos
+	for end < len(runes) && !unicode.IsSpace(runes[end]) {
+		end++
+	}
+	if word := string(runes[pos:end]); word == "OR" || word == "|" {
+		return nil, end, nil
+	}
+	term := &Term{}
+	if runes[pos] == '-' {
+		term.Negated = true
+		pos++
+	}
+	keyEnd := pos
+	for keyEnd < len(runes) && unicode.IsLetter(runes[keyEnd]) {
+		keyEnd++
+	}
+	op, opLen := readOperator(runes[keyEnd:])
+	valueStart := pos
+	if keyEnd > pos && opLen > 0 {
+		name := string(runes[pos:keyEnd])
+		field, ok := ParseField(name)
+		if !ok {
+			return nil, end, fmt.Errorf("%w %s", ErrUnknownField, name)
+		}
+		term.Field = field
+		term.Op = op
+		valueStart = keyEnd + opLen
+	}
+	value, next, err := readValue(runes, valueStart)
+	if err != nil {
+		return nil, next, err
+	}
+	term.Value = value
+	if term.Field == "" && value == "" {
+		return nil, next, ErrEmptyTerm
+	}
+	if term.match, err = compile(term); err != nil {
+		return nil, next, err
+	}
+	return term, next, nil
+}
+
+func readOperator(runes []rune) (Operator, int) {
+	for _, op := range operators {
+		text := []rune(op.String())
+		if len(runes) >= len(text) && string(runes[:len(text)]) == string(text) {
+			return op, len(text)
+		}
+	}
+	return Match, 0
+}
+
+// readValue reads a quoted phrase with \" and \\ escapes or a word up to a space.
+func readValue(runes []rune, pos int) (string, int, error) {
+	if pos >= len(runes) || runes[pos] != '"' {
+		end := pos
+		for end < len(runes) && !unicode.IsSpace(runes[end]) {
+			end++
+		}
+		return string(runes[pos:end]), end, nil
+	}
+	var value strings.Builder
+	for idx := pos + 1; idx < len(runes); idx++ {
+		switch r := runes[idx]; {
+		case r == '\\' && idx+1 < len(runes):
+			idx++
+			value.WriteRune(runes[idx])
+		case r == '"':
+			return value.String(), idx + 1, nil
+		default:
+			value.WriteRune(r)
+		}
+	}
+	return "", len(runes), ErrUnterminatedQuote
+}
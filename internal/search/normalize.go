@@ -0,0 +1,118 @@
+/*
+Package search normalizes names for matching: the same name written in Cyrillic or in Latin
+with any common transliteration scheme gets the same key, so "Стругацкий", "Strugatsky",
+"Strugackij" and "Strugatskii" all become "strugacki".
+*/
+package search
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// cyrillic maps letters of Russian, Ukrainian and Belarusian to the Latin letters keys are built from.
+var cyrillic = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e", 'ж': "zh", 'з': "z",
+	'и': "i", 'й': "i", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o", 'п': "p", 'р': "r",
+	'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "h", 'ц': "c", 'ч': "ch", 'ш': "sh", 'щ': "sh",
+	'ъ': "", 'ы': "i", 'ь': "", 'э': "e", 'ю': "iu", 'я': "ia",
+	'є': "ie", 'і': "i", 'ї': "i", 'ґ': "g", 'ў': "u",
+}
+
+// caron letters of ISO 9 and scholarly transliteration which stand for two Latin letters.
+var caron = map[rune]string{
+	'č': "ch", 'š': "sh", 'ž': "zh", 'ŝ': "sh",
+}
+
+/*
+latin folds spellings of the same sound used by BGN/PCGN, GOST 7.79, ISO 9, passport
+and Polish-like schemes into one. Longer sequences go first, so "shch" isn't taken for "sh" + "ch".
+*/
+var latin = strings.NewReplacer(
+	"shch", "sh", "sch", "sh", "shh", "sh",
+	"tch", "ch", "cz", "ch", "sz", "sh",
+	"kh", "h", "ts", "c", "tz", "c", "x", "ks", "w", "v", "q", "k",
+	"yo", "e", "jo", "e", "ye", "e", "je", "e",
+	"ya", "ia", "ja", "ia", "yu", "iu", "ju", "iu",
+	"y", "i", "j", "i",
+)
+
+var stripMarks = transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+
+// Fold lower cases the text, folds ё into е and strips diacritics from Latin letters, e.g. "Ёлкин Björn" is "елкин bjorn".
+func Fold(text string) string {
+	text = strings.Map(func(r rune) rune {
+		r = unicode.ToLower(r)
+		if r == 'ё' {
+			return 'е'
+		}
+		return r
+	}, text)
+	if plain(text) {
+		return text
+	}
+	// й must keep its breve, it is a letter on its own
+	text = strings.ReplaceAll(text, "й", "\x00")
+	if stripped, _, err := transform.String(stripMarks, text); err == nil {
+		text = stripped
+	}
+	return strings.ReplaceAll(text, "\x00", "й")
+}
+
+// plain reports whether the text has only ASCII and basic Russian letters, nothing to strip as й is kept anyway.
+func plain(text string) bool {
+	for _, r := range text {
+		if r >= utf8.RuneSelf && (r < 'а' || r > 'я') {
+			return false
+		}
+	}
+	return true
+}
+
+// Key transliterates the word into the Latin skeleton used for matching, see the package comment.
+func Key(word string) string {
+	var b strings.Builder
+	b.Grow(len(word))
+	// both tables have no ASCII letters, so most runes skip the lookups
+	for _, r := range strings.ToLower(word) {
+		if r >= utf8.RuneSelf {
+			if letters, ok := caron[r]; ok {
+				b.WriteString(letters)
+				continue
+			}
+		}
+		b.WriteRune(r)
+	}
+	folded := Fold(b.String())
+	b.Reset()
+	b.Grow(len(folded))
+	for _, r := range folded {
+		if r >= utf8.RuneSelf {
+			if letters, ok := cyrillic[r]; ok {
+				b.WriteString(letters)
+				continue
+			}
+		}
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsSpace(r) {
+			b.WriteRune(r)
+		}
+	}
+	key := latin.Replace(b.String())
+	// doubled letters are often dropped in transliteration, e.g. "Strugatskii" and "Strugatski"
+	b.Reset()
+	b.Grow(len(key))
+	var last rune
+	for _, r := range key {
+		if r == last {
+			continue
+		}
+		b.WriteRune(r)
+		last = r
+	}
+	return b.String()
+}
@@ -0,0 +1,43 @@
+package search
+
+import "slices"
+
+// DefaultThreshold is the lowest Similarity of a word to a name part which still counts as a match.
+const DefaultThreshold = 0.4
+
+// MinFuzzyLen is the shortest key matched by similarity, shorter ones only match beginnings of name parts.
+const MinFuzzyLen = 3
+
+// Trigrams returns distinct three letter sequences of the key padded with spaces, e.g. "  a", " ab", "abc", "bc ".
+func Trigrams(key string) []string {
+	padded := []rune("  " + key + " ")
+	trigrams := make([]string, 0, len(padded)-2)
+	for idx := 0; idx+3 <= len(padded); idx++ {
+		trigram := string(padded[idx : idx+3])
+		if !slices.Contains(trigrams, trigram) {
+			trigrams = append(trigrams, trigram)
+		}
+	}
+	return trigrams
+}
+
+// Similarity is the share of common trigrams of two keys from 0 for unrelated keys to 1 for equal ones.
+func Similarity(a, b string) float64 {
+	first, second := Trigrams(a), Trigrams(b)
+	shared := 0
+	for _, trigram := range first {
+		if slices.Contains(second, trigram) {
+			shared++
+		}
+	}
+	return Jaccard(shared, len(first), len(second))
+}
+
+// Jaccard is the similarity of sets with the given sizes and number of shared items.
+func Jaccard(shared, first, second int) float64 {
+	union := first + second - shared
+	if union == 0 {
+		return 0
+	}
+	return float64(shared) / float64(union)
+}
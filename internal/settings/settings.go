@@ -0,0 +1,74 @@
+// Package settings keeps user preferences between sessions in a JSON file under the XDG config dir.
+package settings
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/adrg/xdg"
+)
+
+const (
+	appDir   = "PoorBookExtractor"
+	fileName = "settings.json"
+)
+
+// Settings are preferences saved between sessions, empty fields mean defaults.
+type Settings struct {
+	// BookOrder is the String of entities.BookOrder
+	BookOrder string `json:"book_order,omitempty"`
+}
+
+// Store reads and writes settings in one file.
+type Store struct {
+	path string
+}
+
+func New(path string) *Store {
+	return &Store{path: path}
+}
+
+func NewDefault() *Store {
+	return New(filepath.Join(xdg.ConfigHome, appDir, fileName))
+}
+
+// Load returns saved settings, defaults if nothing is saved yet.
+func (s *Store) Load() (Settings, error) {
+	var settings Settings
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return settings, nil
+	}
+	if err != nil {
+		return settings, err
+	}
+	err = json.Unmarshal(data, &settings)
+	return settings, err
+}
+
+// Save replaces saved settings, the file is never left half written.
+func (s *Store) Save(settings Settings) error {
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(s.path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(dir, "*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), s.path)
+}
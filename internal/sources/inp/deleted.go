@@ -0,0 +1,57 @@
+package inp
+
+import "github.com/HoskeOwl/PoorBookExtractor/internal/entities"
+
+// DeletedMode controls what to do with records marked by the DEL flag.
+type DeletedMode int
+
+const (
+	ExcludeDeleted DeletedMode = iota
+	IncludeDeleted
+	OnlyDeleted
+)
+
+var DeletedModes = []DeletedMode{ExcludeDeleted, IncludeDeleted, OnlyDeleted}
+
+func (m DeletedMode) String() string {
+	switch m {
+	case IncludeDeleted:
+		return "include"
+	case OnlyDeleted:
+		return "only"
+	default:
+		return "exclude"
+	}
+}
+
+func ParseDeletedMode(value string) DeletedMode {
+	for _, mode := range DeletedModes {
+		if mode.String() == value {
+			return mode
+		}
+	}
+	return ExcludeDeleted
+}
+
+func parseDeleted(field string) bool {
+	return field != "" && field != "0"
+}
+
+// Accept reports whether the book is loaded in the mode.
+func (m DeletedMode) Accept(book *entities.Book) bool {
+	switch m {
+	case ExcludeDeleted:
+		return !book.Deleted
+	case OnlyDeleted:
+		return book.Deleted
+	}
+	return true
+}
+
+// filterDeleted returns ErrDeleted when the book must be skipped in the given mode.
+func filterDeleted(book *entities.Book, mode DeletedMode) error {
+	if !mode.Accept(book) {
+		return ErrDeleted
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package inp
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/HoskeOwl/PoorBookExtractor/internal/entities"
+)
+
+// DuplicatePolicy controls what to do with a record whose LibID is already loaded.
+type DuplicatePolicy int
+
+const (
+	// KeepLast replaces the loaded book, it is how catalogs were always loaded
+	KeepLast DuplicatePolicy = iota
+	KeepFirst
+	// KeepNewest keeps the book with the latest Date, the later record wins on equal dates
+	KeepNewest
+	// KeepBoth stores the later book as a duplicate (see entities.Book.Duplicate), its LibID is kept
+	KeepBoth
+)
+
+var DuplicatePolicies = []DuplicatePolicy{KeepLast, KeepFirst, KeepNewest, KeepBoth}
+
+func (p DuplicatePolicy) String() string {
+	switch p {
+	case KeepFirst:
+		return "first"
+	case KeepNewest:
+		return "newest"
+	case KeepBoth:
+		return "both"
+	default:
+		return "last"
+	}
+}
+
+func ParseDuplicatePolicy(value string) DuplicatePolicy {
+	for _, policy := range DuplicatePolicies {
+		if policy.String() == value {
+			return policy
+		}
+	}
+	return KeepLast
+}
+
+// CompositeLibID makes LibID of a duplicate unique by the archive it comes from.
+func CompositeLibID(libID, archive string) string {
+	return libID + "@" + archive
+}
+
+// Collision is a LibID met more than once.
+type Collision struct {
+	LibID string
+	// Existing and Incoming are archives of the already loaded and the new book
+	Existing string
+	Incoming string
+	// Replaced reports whether the new book replaced the loaded one
+	Replaced bool
+	// Key is the composite LibID (see CompositeLibID) the new book is told apart by when both are kept
+	Key string
+}
+
+func (c Collision) Resolution() string {
+	switch {
+	case c.Key != "":
+		return "kept both as " + c.Key
+	case c.Replaced:
+		return "replaced"
+	default:
+		return "ignored"
+	}
+}
+
+type seenBook struct {
+	archive string
+	date    time.Time
+}
+
+// Duplicates tracks LibIDs of added books and resolves repeated ones by the policy.
+type Duplicates struct {
+	policy     DuplicatePolicy
+	seen       map[string]seenBook
+	Collisions []Collision
+}
+
+func NewDuplicates(policy DuplicatePolicy) *Duplicates {
+	return &Duplicates{policy: policy, seen: make(map[string]seenBook)}
+}
+
+func (d *Duplicates) Policy() DuplicatePolicy {
+	return d.policy
+}
+
+/*
+Resolve reports whether the book has to be stored.
+A book kept by KeepBoth gets Duplicate set, so it doesn't replace the loaded one, its LibID stays as in the catalog.
+*/
+func (d *Duplicates) Resolve(book *entities.Book) bool {
+	incoming := seenBook{archive: book.Metadata.ArchiveName, date: book.Date}
+	existing, ok := d.seen[book.LibID]
+	if !ok {
+		d.seen[book.LibID] = incoming
+		return true
+	}
+	collision := Collision{LibID: book.LibID, Existing: existing.archive, Incoming: incoming.archive}
+	switch d.policy {
+	case KeepFirst:
+	case KeepNewest:
+		collision.Replaced = !existing.date.After(incoming.date)
+	case KeepBoth:
+		book.Duplicate = d.duplicate(book)
+		collision.Key = CompositeLibID(book.LibID, book.Duplicate)
+	default:
+		collision.Replaced = true
+	}
+	d.Collisions = append(d.Collisions, collision)
+	switch {
+	case collision.Key != "":
+		d.seen[collision.Key] = incoming
+		return true
+	case collision.Replaced:
+		d.seen[book.LibID] = incoming
+		return true
+	}
+	return false
+}
+
+// Replaced returns the number of stored books which replaced already stored ones.
+func (d *Duplicates) Replaced() int {
+	replaced := 0
+	for _, collision := range d.Collisions {
+		if collision.Replaced {
+			replaced++
+		}
+	}
+	return replaced
+}
+
+// duplicate returns an unused Duplicate of the book, the archive name numbered if the archive repeats the record several times.
+func (d *Duplicates) duplicate(book *entities.Book) string {
+	duplicate := book.Metadata.ArchiveName
+	for n := 2; ; n++ {
+		if _, ok := d.seen[CompositeLibID(book.LibID, duplicate)]; !ok {
+			return duplicate
+		}
+		duplicate = fmt.Sprintf("%s.%d", book.Metadata.ArchiveName, n)
+	}
+}
@@ -0,0 +1,129 @@
+package inp
+
+import (
+	"bufio"
+	"io"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/transform"
+)
+
+// Encoding of inp files, old catalogs are written in cp1251 or koi8-r instead of UTF-8.
+type Encoding int
+
+const (
+	// AutoEncoding detects the encoding of every file
+	AutoEncoding Encoding = iota
+	UTF8
+	Windows1251
+	KOI8R
+)
+
+var Encodings = []Encoding{AutoEncoding, UTF8, Windows1251, KOI8R}
+
+// detectSampleSize is the part of a file the encoding is detected by.
+const detectSampleSize = 64 * 1024
+
+func (e Encoding) String() string {
+	switch e {
+	case UTF8:
+		return "utf-8"
+	case Windows1251:
+		return "windows-1251"
+	case KOI8R:
+		return "koi8-r"
+	default:
+		return "auto"
+	}
+}
+
+func ParseEncoding(value string) Encoding {
+	for _, encoding := range Encodings {
+		if encoding.String() == value {
+			return encoding
+		}
+	}
+	return AutoEncoding
+}
+
+// validUTF8 ignores a rune cut by the end of the sample.
+func validUTF8(sample []byte) bool {
+	for cut := 0; cut < utf8.UTFMax && cut <= len(sample); cut++ {
+		if utf8.Valid(sample[:len(sample)-cut]) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+DetectEncoding guesses the encoding of the text.
+Anything valid as UTF-8 is UTF-8. Otherwise cp1251 and koi8-r are told apart by the case of letters:
+most letters of names and titles are lowercase, they are 0xE0-0xFF in cp1251 and 0xC0-0xDF in koi8-r.
+*/
+func DetectEncoding(sample []byte) Encoding {
+	if validUTF8(sample) {
+		return UTF8
+	}
+	upperHalf, lowerHalf := 0, 0
+	for _, b := range sample {
+		switch {
+		case b >= 0xE0:
+			upperHalf++
+		case b >= 0xC0:
+			lowerHalf++
+		}
+	}
+	if lowerHalf > upperHalf {
+		return KOI8R
+	}
+	return Windows1251
+}
+
+func (e Encoding) decoder() transform.Transformer {
+	switch e {
+	case Windows1251:
+		return charmap.Windows1251.NewDecoder()
+	case KOI8R:
+		return charmap.KOI8R.NewDecoder()
+	}
+	return nil
+}
+
+/*
+NewDecodingReader returns a reader of UTF-8 text and the encoding of the source.
+AutoEncoding detects the encoding by the beginning of the source.
+*/
+func NewDecodingReader(r io.Reader, encoding Encoding) (io.Reader, Encoding, error) {
+	if encoding == AutoEncoding {
+		buffered := bufio.NewReaderSize(r, detectSampleSize)
+		sample, err := buffered.Peek(detectSampleSize)
+		if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+			return nil, encoding, err
+		}
+		encoding = DetectEncoding(sample)
+		r = buffered
+	}
+	decoder := encoding.decoder()
+	if decoder == nil {
+		return r, encoding, nil
+	}
+	return transform.NewReader(r, decoder), encoding, nil
+}
+
+// DecodeBytes converts the text to UTF-8, AutoEncoding detects the encoding by the whole text.
+func DecodeBytes(data []byte, encoding Encoding) ([]byte, Encoding) {
+	if encoding == AutoEncoding {
+		encoding = DetectEncoding(data)
+	}
+	decoder := encoding.decoder()
+	if decoder == nil {
+		return data, encoding
+	}
+	decoded, _, err := transform.Bytes(decoder, data)
+	if err != nil {
+		return data, UTF8
+	}
+	return decoded, encoding
+}
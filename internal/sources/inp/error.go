@@ -1,7 +1,49 @@
 package inp
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var ErrDeleted = errors.New("deleted book")
 var ErrInvalidSize = errors.New("invalid size")
 var ErrInvalidDate = errors.New("invalid date")
+var ErrEmptyStructure = errors.New("empty structure")
+var ErrNotEnoughFields = errors.New("not enough fields")
+
+var recordErrorKinds = []error{ErrNotEnoughFields, ErrInvalidSize, ErrInvalidDate, ErrDeleted}
+
+// KindByReason returns the sentinel error with the text, it restores kinds of stored reports.
+func KindByReason(reason string) error {
+	for _, kind := range recordErrorKinds {
+		if kind.Error() == reason {
+			return kind
+		}
+	}
+	return errors.New(reason)
+}
+
+// RecordError describes a rejected inp record.
+type RecordError struct {
+	Line int
+	Raw  string
+	Err  error
+}
+
+func (e *RecordError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Err)
+}
+
+func (e *RecordError) Unwrap() error {
+	return e.Err
+}
+
+// Kind returns the sentinel error describing why the record was rejected.
+func (e *RecordError) Kind() error {
+	for _, kind := range recordErrorKinds {
+		if errors.Is(e.Err, kind) {
+			return kind
+		}
+	}
+	return e.Err
+}
@@ -2,9 +2,10 @@ package inp
 
 import (
 	"bufio"
-	"bytes"
 	"context"
 	"fmt"
+	"io"
+	"iter"
 	"strconv"
 	"strings"
 	"time"
@@ -17,27 +18,14 @@ import (
 const (
 	separator   = "\x04"
 	endOfRecord = "\r\n"
-	columnCount = 14
-
-	authorIndex       = 0
-	genreIndex        = 1
-	titleIndex        = 2
-	seriesIndex       = 3
-	seriesNumberIndex = 4
-	fileIndex         = 5
-	sizeIndex         = 6
-	libIDIndex        = 7
-	delIndex          = 8
-	extIndex          = 9
-	dateIndex         = 10
-	langIndex         = 11
-	librateIndex      = 12
-	keywordsIndex     = 13
+
+	initialLineSize = 4 * 1024
+	maxLineSize     = 1024 * 1024
 )
 
 /*
-inp structure:
-AUTHOR;GENRE;TITLE;SERIES;SERNO;FILE_TYPE;SIZE;LIBID;DEL;EXT;DATE;LANG;KEYWORDS;<CR><LF>
+inp structure (default, may be overridden by structure.info):
+AUTHOR;GENRE;TITLE;SERIES;SERNO;FILE_TYPE;SIZE;LIBID;DEL;EXT;DATE;LANG;LIBRATE;KEYWORDS;<CR><LF>
 separator of fields (instead of ';') - <0x04>
 end of record - <CR><LF> - <0x0D,0x0A>
 */
@@ -48,13 +36,12 @@ class Book(namedtuple("Book", "authors genres title series ser_no filename size
 
 */
 
-func parseAuthors(field string) []string {
+func parseAuthors(field string) []entities.Author {
 	raw := strings.Split(field, ":")
-	authors := make([]string, 0, len(raw))
-	for _, author := range raw {
-		author = strings.ReplaceAll(author, ",", " ")
-		author = strings.TrimSpace(author)
-		if author == "" {
+	authors := make([]entities.Author, 0, len(raw))
+	for _, value := range raw {
+		author := entities.ParseAuthor(value)
+		if author.IsEmpty() {
 			continue
 		}
 		authors = append(authors, author)
@@ -88,63 +75,114 @@ func parseKeywords(field string) []string {
 	return keywords
 }
 
-func parseBook(ctx context.Context, fields []string) (entities.Book, error) {
-	log := logs.GetFromContext(ctx)
+// maxRating is the highest LIBRATE, ratings are shown as that many stars.
+const maxRating = 5
 
-	if len(fields) < columnCount {
-		log.Error("not enough fields in book", zap.Int("count", len(fields)), zap.Strings("fields", fields))
-		return entities.Book{}, fmt.Errorf("not enough fields in book: %v", fields)
+// parseRating never fails: LIBRATE is often empty or filled with garbage by catalog generators.
+// Ratings out of 0..maxRating are clamped.
+func parseRating(ctx context.Context, field string) int {
+	field = strings.TrimSpace(field)
+	if field == "" {
+		return 0
 	}
-	if len(fields) > columnCount {
-		fields = fields[:columnCount]
+	rating, err := strconv.Atoi(field)
+	if err != nil {
+		logs.GetFromContext(ctx).Debug("error parsing rating", zap.String("error", err.Error()), zap.String("rating", field))
+		return 0
 	}
+	if rating < 0 || rating > maxRating {
+		logs.GetFromContext(ctx).Debug("rating out of range", zap.Int("rating", rating), zap.Int("max", maxRating))
+		return min(max(rating, 0), maxRating)
+	}
+	return rating
+}
 
-	size, err := strconv.ParseInt(fields[sizeIndex], 10, 64)
-	if err != nil {
-		log.Error("error parsing size", zap.String("error", err.Error()), zap.String("size", fields[sizeIndex]))
-		return entities.Book{}, ErrInvalidSize
+func parseBook(ctx context.Context, structure *Structure, fields []string) (entities.Book, error) {
+	log := logs.GetFromContext(ctx)
+
+	if len(fields) < structure.Len() {
+		log.Debug("not enough fields in book", zap.Int("count", len(fields)), zap.Strings("fields", fields))
+		return entities.Book{}, fmt.Errorf("%w: got %d of %d", ErrNotEnoughFields, len(fields), structure.Len())
 	}
 
-	date, err := time.Parse("2006-01-02", fields[dateIndex])
-	if err != nil {
-		log.Error("error parsing date", zap.String("error", err.Error()), zap.String("date", fields[dateIndex]))
-		return entities.Book{}, ErrInvalidDate
+	var size int64
+	var err error
+	if structure.Has(FieldSize) {
+		size, err = strconv.ParseInt(structure.Get(fields, FieldSize), 10, 64)
+		if err != nil {
+			log.Debug("error parsing size", zap.String("error", err.Error()), zap.String("size", structure.Get(fields, FieldSize)))
+			return entities.Book{}, ErrInvalidSize
+		}
+	}
+
+	var date time.Time
+	if structure.Has(FieldDate) {
+		date, err = time.Parse("2006-01-02", structure.Get(fields, FieldDate))
+		if err != nil {
+			log.Debug("error parsing date", zap.String("error", err.Error()), zap.String("date", structure.Get(fields, FieldDate)))
+			return entities.Book{}, ErrInvalidDate
+		}
 	}
 
 	return entities.Book{
-		Authors:      parseAuthors(fields[authorIndex]),
-		Genres:       parseGenres(fields[genreIndex]),
-		Title:        fields[titleIndex],
-		Series:       fields[seriesIndex],
-		SeriesNumber: fields[seriesNumberIndex],
-		Filename:     fields[fileIndex],
+		Authors:      parseAuthors(structure.Get(fields, FieldAuthor)),
+		Genres:       parseGenres(structure.Get(fields, FieldGenre)),
+		Title:        structure.Get(fields, FieldTitle),
+		Series:       structure.Get(fields, FieldSeries),
+		SeriesNumber: structure.Get(fields, FieldSeriesNumber),
+		Filename:     structure.Get(fields, FieldFile),
 		Size:         size,
-		LibID:        fields[libIDIndex],
-		Ext:          fields[extIndex],
+		LibID:        structure.Get(fields, FieldLibID),
+		Deleted:      parseDeleted(structure.Get(fields, FieldDel)),
+		Ext:          structure.Get(fields, FieldExt),
 		Date:         date,
-		Lang:         fields[langIndex],
-		Keywords:     parseKeywords(fields[keywordsIndex]),
+		Lang:         structure.Get(fields, FieldLang),
+		Rating:       parseRating(ctx, structure.Get(fields, FieldLibrate)),
+		Keywords:     parseKeywords(structure.Get(fields, FieldKeywords)),
+		Folder:       strings.TrimSpace(structure.Get(fields, FieldFolder)),
 	}, nil
 }
 
-func ParseBooksWithMetadataInplace(ctx context.Context, inp []byte, metadata entities.BookMetadata, storage map[string]entities.Book) error {
-	log := logs.GetFromContext(ctx).With(zap.String("action", "parse_books_with_metadata"))
-	ctx = logs.WithLog(ctx, log)
-
-	scanner := bufio.NewScanner(bytes.NewReader(inp))
-	count := 0
-	for scanner.Scan() {
-		line := scanner.Text()
-		fields := strings.Split(line, "\x04")
-		book, err := parseBook(ctx, fields)
-		if err != nil {
-			log.Error("error parsing book", zap.String("error", err.Error()))
-			continue
+// ParseBooks reads inp records one by one and yields parsed books.
+// Broken records are yielded with *RecordError and parsing continues, a read error is yielded last.
+// Records filtered out by the deleted mode are skipped silently.
+func ParseBooks(ctx context.Context, r io.Reader, structure *Structure, metadata entities.BookMetadata, deleted DeletedMode) iter.Seq2[entities.Book, error] {
+	return func(yield func(entities.Book, error) bool) {
+		log := logs.GetFromContext(ctx).With(zap.String("action", "parse_books"))
+		ctx := logs.WithLog(ctx, log)
+
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 0, initialLineSize), maxLineSize)
+		count := 0
+		lineNumber := 0
+		for scanner.Scan() {
+			lineNumber++
+			line := scanner.Text()
+			if line == "" {
+				continue
+			}
+			fields := strings.Split(line, separator)
+			book, err := parseBook(ctx, structure, fields)
+			if err != nil {
+				if !yield(entities.Book{}, &RecordError{Line: lineNumber, Raw: line, Err: err}) {
+					return
+				}
+				continue
+			}
+			if err = filterDeleted(&book, deleted); err != nil {
+				log.Debug("skipping book", zap.String("libID", book.LibID), zap.Bool("deleted", book.Deleted))
+				continue
+			}
+			book.Metadata = metadata
+			count++
+			if !yield(book, nil) {
+				return
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			yield(entities.Book{}, err)
+			return
 		}
-		book.Metadata = metadata
-		storage[book.LibID] = book
-		count++
+		log.Debug("books parsed:", zap.Int("count", count))
 	}
-	log.Debug("books parsed:", zap.Int("count", count))
-	return nil
 }
@@ -0,0 +1,100 @@
+package inp
+
+import (
+	"strings"
+)
+
+type Field string
+
+const (
+	FieldAuthor       Field = "AUTHOR"
+	FieldGenre        Field = "GENRE"
+	FieldTitle        Field = "TITLE"
+	FieldSeries       Field = "SERIES"
+	FieldSeriesNumber Field = "SERNO"
+	FieldFile         Field = "FILE"
+	FieldSize         Field = "SIZE"
+	FieldLibID        Field = "LIBID"
+	FieldDel          Field = "DEL"
+	FieldExt          Field = "EXT"
+	FieldDate         Field = "DATE"
+	FieldLang         Field = "LANG"
+	FieldLibrate      Field = "LIBRATE"
+	FieldKeywords     Field = "KEYWORDS"
+	FieldFolder       Field = "FOLDER"
+	FieldInsNo        Field = "INSNO"
+)
+
+/*
+Structure describes the order of fields in inp records of one catalog.
+It is declared in structure.info inside the inpx, e.g.
+AUTHOR;GENRE;TITLE;SERIES;SERNO;FILE;SIZE;LIBID;DEL;EXT;DATE;INSNO;FOLDER;LANG;KEYWORDS;
+Unknown fields keep their position but are ignored.
+*/
+type Structure struct {
+	fields []Field
+	index  map[Field]int
+}
+
+var DefaultStructure = NewStructure([]Field{
+	FieldAuthor, FieldGenre, FieldTitle, FieldSeries, FieldSeriesNumber, FieldFile, FieldSize,
+	FieldLibID, FieldDel, FieldExt, FieldDate, FieldLang, FieldLibrate, FieldKeywords,
+})
+
+func NewStructure(fields []Field) *Structure {
+	index := make(map[Field]int, len(fields))
+	for idx, field := range fields {
+		if _, ok := index[field]; ok {
+			continue
+		}
+		index[field] = idx
+	}
+	return &Structure{fields: fields, index: index}
+}
+
+func ParseStructure(data []byte) (*Structure, error) {
+	line := strings.TrimPrefix(string(data), "\ufeff")
+	if idx := strings.IndexAny(line, "\r\n"); idx >= 0 {
+		line = line[:idx]
+	}
+	line = strings.TrimSuffix(strings.TrimSpace(line), ";")
+	if line == "" {
+		return nil, ErrEmptyStructure
+	}
+	raw := strings.Split(line, ";")
+	fields := make([]Field, 0, len(raw))
+	for _, field := range raw {
+		fields = append(fields, Field(strings.ToUpper(strings.TrimSpace(field))))
+	}
+	return NewStructure(fields), nil
+}
+
+func (s *Structure) Len() int {
+	return len(s.fields)
+}
+
+func (s *Structure) Fields() []Field {
+	return s.fields
+}
+
+func (s *Structure) Has(field Field) bool {
+	_, ok := s.index[field]
+	return ok
+}
+
+// Get returns the value of the field from the split record or empty string if catalog has no such field.
+func (s *Structure) Get(record []string, field Field) string {
+	idx, ok := s.index[field]
+	if !ok || idx >= len(record) {
+		return ""
+	}
+	return record[idx]
+}
+
+func (s *Structure) String() string {
+	raw := make([]string, 0, len(s.fields))
+	for _, field := range s.fields {
+		raw = append(raw, string(field))
+	}
+	return strings.Join(raw, ";") + ";"
+}
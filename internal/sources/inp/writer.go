@@ -0,0 +1,98 @@
+package inp
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/HoskeOwl/PoorBookExtractor/internal/entities"
+)
+
+var fieldCleaner = strings.NewReplacer(separator, " ", "\r", " ", "\n", " ")
+
+func formatAuthors(authors []entities.Author) string {
+	var sb strings.Builder
+	for _, author := range authors {
+		sb.WriteString(author.Raw())
+		sb.WriteString(":")
+	}
+	return sb.String()
+}
+
+func formatGenres(genres []string) string {
+	if len(genres) == 0 {
+		return ""
+	}
+	return strings.Join(genres, ":") + ":"
+}
+
+func formatDeleted(deleted bool) string {
+	if deleted {
+		return "1"
+	}
+	return ""
+}
+
+func formatRating(rating int) string {
+	if rating <= 0 {
+		return ""
+	}
+	return strconv.Itoa(rating)
+}
+
+// formatField returns the value of the field, the book keeps no INSNO so it is always empty.
+func formatField(book *entities.Book, field Field) string {
+	switch field {
+	case FieldAuthor:
+		return formatAuthors(book.Authors)
+	case FieldGenre:
+		return formatGenres(book.Genres)
+	case FieldTitle:
+		return book.Title
+	case FieldSeries:
+		return book.Series
+	case FieldSeriesNumber:
+		return book.SeriesNumber
+	case FieldFile:
+		return book.Filename
+	case FieldSize:
+		return strconv.FormatInt(book.Size, 10)
+	case FieldLibID:
+		return book.LibID
+	case FieldDel:
+		return formatDeleted(book.Deleted)
+	case FieldExt:
+		return book.Ext
+	case FieldDate:
+		return book.Date.Format(time.DateOnly)
+	case FieldLang:
+		return book.Lang
+	case FieldLibrate:
+		return formatRating(book.Rating)
+	case FieldKeywords:
+		return strings.Join(book.Keywords, ":")
+	case FieldFolder:
+		return book.Metadata.ArchiveName
+	}
+	return ""
+}
+
+// FormatBook returns the inp record of the book in the order of the structure, separators are removed from values.
+func FormatBook(structure *Structure, book *entities.Book) string {
+	fields := make([]string, 0, structure.Len())
+	for _, field := range structure.Fields() {
+		fields = append(fields, fieldCleaner.Replace(formatField(book, field)))
+	}
+	return strings.Join(fields, separator) + separator + endOfRecord
+}
+
+// WriteBooks writes inp records of books, the result is read back by ParseBooks with the same structure.
+func WriteBooks(w io.Writer, structure *Structure, books []*entities.Book) error {
+	for _, book := range books {
+		if _, err := io.WriteString(w, FormatBook(structure, book)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
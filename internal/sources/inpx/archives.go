@@ -0,0 +1,154 @@
+package inpx
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/HoskeOwl/PoorBookExtractor/internal/entities"
+)
+
+var ErrArchiveNotFound = errors.New("archive not found")
+
+/*
+ArchiveResolver proposes the archive of a book relative to the inpx directory,
+empty string means the resolver has nothing to propose.
+member is the name of the inp file the book was read from.
+*/
+type ArchiveResolver interface {
+	Archive(member string, book *entities.Book) string
+}
+
+// FolderResolver takes the archive from the FOLDER column, a name without extension is a zip.
+type FolderResolver struct{}
+
+func (FolderResolver) Archive(_ string, book *entities.Book) string {
+	folder := filepath.FromSlash(strings.ReplaceAll(book.Folder, "\\", "/"))
+	if folder == "" || filepath.Ext(folder) != "" {
+		return folder
+	}
+	return folder + ".zip"
+}
+
+func (FolderResolver) String() string {
+	return "folder"
+}
+
+// InpNameResolver is the common convention: books of fb2-000001-000100.inp are in fb2-000001-000100.zip.
+type InpNameResolver struct{}
+
+func (InpNameResolver) Archive(member string, _ *entities.Book) string {
+	return filepath.FromSlash(strings.TrimSuffix(member, path.Ext(member)) + ".zip")
+}
+
+func (InpNameResolver) String() string {
+	return "inp-name"
+}
+
+// MappingResolver is a user rule: the inp name is matched by the pattern and replaced, e.g. `^(.*)\.inp$` -> `archives/$1.zip`.
+type MappingResolver struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+func NewMappingResolver(pattern, replacement string) (*MappingResolver, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return &MappingResolver{pattern: re, replacement: replacement}, nil
+}
+
+func (r *MappingResolver) Archive(member string, _ *entities.Book) string {
+	if !r.pattern.MatchString(member) {
+		return ""
+	}
+	return filepath.FromSlash(r.pattern.ReplaceAllString(member, r.replacement))
+}
+
+func (r *MappingResolver) Pattern() string {
+	return r.pattern.String()
+}
+
+func (r *MappingResolver) Replacement() string {
+	return r.replacement
+}
+
+func (r *MappingResolver) String() string {
+	return fmt.Sprintf("%s -> %s", r.pattern, r.replacement)
+}
+
+// DefaultResolvers are FOLDER column first, then the inp name convention.
+func DefaultResolvers() []ArchiveResolver {
+	return []ArchiveResolver{FolderResolver{}, InpNameResolver{}}
+}
+
+// archiveLocator checks proposals of resolvers in order and takes the first existing archive.
+type archiveLocator struct {
+	root      string
+	resolvers []ArchiveResolver
+
+	mu     sync.Mutex
+	exists map[string]bool
+}
+
+func newArchiveLocator(root string, resolvers []ArchiveResolver) *archiveLocator {
+	return &archiveLocator{root: root, resolvers: resolvers, exists: make(map[string]bool)}
+}
+
+func (l *archiveLocator) archiveExists(archive string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	exists, ok := l.exists[archive]
+	if !ok {
+		_, err := os.Stat(filepath.Join(l.root, archive))
+		exists = err == nil
+		l.exists[archive] = exists
+	}
+	return exists
+}
+
+/*
+locate returns the archive of the book. When no proposal exists the first one is returned
+together with all tried names, so the book is still loaded and the problem is reported.
+*/
+func (l *archiveLocator) locate(member string, book *entities.Book) (string, []string, bool) {
+	tried := make([]string, 0, len(l.resolvers))
+	for _, resolver := range l.resolvers {
+		archive := resolver.Archive(member, book)
+		if archive == "" {
+			continue
+		}
+		if l.archiveExists(archive) {
+			return archive, nil, true
+		}
+		tried = append(tried, archive)
+	}
+	if len(tried) == 0 {
+		return "", nil, false
+	}
+	return tried[0], tried, false
+}
+
+// MissingArchive is an archive of books which was not found next to the inpx.
+type MissingArchive struct {
+	Member  string
+	Archive string
+	// Tried are all names proposed by resolvers
+	Tried []string
+	Books int
+}
+
+func (m MissingArchive) Error() string {
+	return fmt.Sprintf("%s: %s (tried %s) for %d books of %s",
+		ErrArchiveNotFound, m.Archive, strings.Join(m.Tried, ", "), m.Books, m.Member)
+}
+
+func (m MissingArchive) Unwrap() error {
+	return ErrArchiveNotFound
+}
@@ -60,14 +60,14 @@ func ExportBooks(path string, books []*entities.Book) error {
 	if err != nil {
 		return err
 	}
+	// books may come from different libraries, so archives are resolved against the root of each book
 	bookByArchive := make(map[string][]*entities.Book)
 	for _, book := range books {
-		bookByArchive[book.Metadata.ArchiveName] = append(bookByArchive[book.Metadata.ArchiveName], book)
+		archive := filepath.Join(book.Metadata.Filepath, book.Metadata.ArchiveName)
+		bookByArchive[archive] = append(bookByArchive[archive], book)
 	}
-	archivePath := books[0].Metadata.Filepath
 	for archive, books := range bookByArchive {
-		p := filepath.Join(archivePath, archive)
-		err = exportBook(p, path, books)
+		err = exportBook(archive, path, books)
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,119 @@
+package inpx
+
+import (
+	"archive/zip"
+	"context"
+	"maps"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/HoskeOwl/PoorBookExtractor/internal/entities"
+	"github.com/HoskeOwl/PoorBookExtractor/internal/genres"
+	"github.com/HoskeOwl/PoorBookExtractor/internal/logs"
+	"github.com/HoskeOwl/PoorBookExtractor/internal/sources/inp"
+	"go.uber.org/zap"
+)
+
+/*
+collection.info structure (one value per line):
+NAME
+ID (file name of the collection)
+TYPE
+DESCRIPTION
+URL (optional)
+
+version.info contains the catalog version, usually the date in YYYYMMDD format
+
+*.glst is an optional catalog-specific genre list
+
+old catalogs write collection.info and *.glst in the same legacy encoding as inp files
+*/
+
+const (
+	collectionInfo = "collection.info"
+	versionInfo    = "version.info"
+	genreListExt   = ".glst"
+)
+
+var versionLayouts = []string{"20060102", time.DateOnly}
+
+func splitInfoLines(data []byte) []string {
+	text := strings.TrimPrefix(string(data), "\ufeff")
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	lines := strings.Split(text, "\n")
+	for idx, line := range lines {
+		lines[idx] = strings.TrimSpace(line)
+	}
+	return lines
+}
+
+func lineAt(lines []string, idx int) string {
+	if idx >= len(lines) {
+		return ""
+	}
+	return lines[idx]
+}
+
+func parseCollectionInfo(data []byte, library *entities.Library) {
+	lines := splitInfoLines(data)
+	library.Name = lineAt(lines, 0)
+	library.ID = lineAt(lines, 1)
+	library.Type = lineAt(lines, 2)
+	library.Description = lineAt(lines, 3)
+	library.URL = lineAt(lines, 4)
+}
+
+func parseVersionInfo(data []byte, library *entities.Library) {
+	library.Version = lineAt(splitInfoLines(data), 0)
+	for _, layout := range versionLayouts {
+		date, err := time.Parse(layout, library.Version)
+		if err == nil {
+			library.Date = date
+			return
+		}
+	}
+}
+
+// readLibrary collects the library description. Both files are optional.
+func (imp *InpxParser) readLibrary(ctx context.Context, zipReader *zip.Reader) entities.Library {
+	log := logs.GetFromContext(ctx)
+	library := entities.Library{}
+	if zipFile := findZipFile(zipReader, collectionInfo); zipFile != nil {
+		data, err := imp.readZipFile(zipFile)
+		if err != nil {
+			log.Error("error reading collection.info", zap.Error(err))
+		} else {
+			data, _ = inp.DecodeBytes(data, imp.encoding)
+			parseCollectionInfo(data, &library)
+		}
+	}
+	if zipFile := findZipFile(zipReader, versionInfo); zipFile != nil {
+		data, err := imp.readZipFile(zipFile)
+		if err != nil {
+			log.Error("error reading version.info", zap.Error(err))
+		} else {
+			parseVersionInfo(data, &library)
+		}
+	}
+	for _, zipFile := range zipReader.File {
+		if !strings.HasSuffix(strings.ToLower(zipFile.Name), genreListExt) {
+			continue
+		}
+		data, err := imp.readZipFile(zipFile)
+		if err != nil {
+			log.Error("error reading genre list", zap.String("filename", zipFile.Name), zap.Error(err))
+			continue
+		}
+		data, _ = inp.DecodeBytes(data, imp.encoding)
+		if library.Genres == nil {
+			library.Genres = make(map[string]string)
+		}
+		maps.Copy(library.Genres, genres.ParseGlst(data))
+	}
+	if library.Name == "" {
+		library.Name = strings.TrimSuffix(imp.filename, filepath.Ext(imp.filename))
+	}
+	log.Debug("library", zap.String("name", library.Name), zap.String("version", library.Version))
+	return library
+}
@@ -4,9 +4,11 @@ import (
 	"archive/zip"
 	"bytes"
 	"context"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"sync/atomic"
 
@@ -19,16 +21,111 @@ import (
 /*
 inpx is a Zip archive, inside of which are text files 'inp'
 nd of record - <CR><LF> - <0x0D,0x0A>
+optional structure.info declares the order of fields in inp records
 */
 
+const (
+	structureInfo = "structure.info"
+	// averageRecordSize is used to preallocate books of an inp file
+	averageRecordSize = 200
+)
+
 type InpxParser struct {
-	filename string
-	path     string
-	progress *atomic.Int32
+	filename   string
+	path       string
+	progress   *atomic.Int32
+	deleted    inp.DeletedMode
+	duplicates inp.DuplicatePolicy
+	resolvers  []ArchiveResolver
+	encoding   inp.Encoding
+	workers    int
+}
+
+type Option func(*InpxParser)
+
+// WithDeletedMode sets how records marked by the DEL flag are loaded.
+func WithDeletedMode(mode inp.DeletedMode) Option {
+	return func(imp *InpxParser) {
+		imp.deleted = mode
+	}
+}
+
+// WithDuplicatePolicy sets how records with an already loaded LibID are resolved.
+func WithDuplicatePolicy(policy inp.DuplicatePolicy) Option {
+	return func(imp *InpxParser) {
+		imp.duplicates = policy
+	}
+}
+
+// WithArchiveResolvers replaces the default way of finding archives of books (see DefaultResolvers).
+func WithArchiveResolvers(resolvers ...ArchiveResolver) Option {
+	return func(imp *InpxParser) {
+		imp.resolvers = resolvers
+	}
+}
+
+// WithEncoding overrides the detection of the encoding of inp files.
+func WithEncoding(encoding inp.Encoding) Option {
+	return func(imp *InpxParser) {
+		imp.encoding = encoding
+	}
 }
 
-func NewInpxParser(filename string) *InpxParser {
-	return &InpxParser{progress: &atomic.Int32{}}
+// WithWorkers limits the number of inp files parsed concurrently.
+func WithWorkers(workers int) Option {
+	return func(imp *InpxParser) {
+		imp.workers = max(workers, 1)
+	}
+}
+
+func NewInpxParser(filename string, opts ...Option) *InpxParser {
+	imp := &InpxParser{progress: &atomic.Int32{}, workers: runtime.NumCPU(), resolvers: DefaultResolvers()}
+	for _, opt := range opts {
+		opt(imp)
+	}
+	return imp
+}
+
+func (imp *InpxParser) SetDeletedMode(mode inp.DeletedMode) {
+	imp.deleted = mode
+}
+
+func (imp *InpxParser) DeletedMode() inp.DeletedMode {
+	return imp.deleted
+}
+
+func (imp *InpxParser) SetDuplicatePolicy(policy inp.DuplicatePolicy) {
+	imp.duplicates = policy
+}
+
+func (imp *InpxParser) DuplicatePolicy() inp.DuplicatePolicy {
+	return imp.duplicates
+}
+
+func (imp *InpxParser) SetEncoding(encoding inp.Encoding) {
+	imp.encoding = encoding
+}
+
+func (imp *InpxParser) Encoding() inp.Encoding {
+	return imp.encoding
+}
+
+// Options describes settings which change the result of parsing, so results parsed with other settings are not reused.
+func (imp *InpxParser) Options() string {
+	resolvers := make([]string, 0, len(imp.resolvers))
+	for _, resolver := range imp.resolvers {
+		resolvers = append(resolvers, fmt.Sprint(resolver))
+	}
+	return fmt.Sprintf("deleted=%s;duplicates=%s;encoding=%s;archives=%s",
+		imp.deleted, imp.duplicates, imp.encoding, strings.Join(resolvers, ","))
+}
+
+// SetArchiveMapping adds the user rule after the default resolvers, nil removes it.
+func (imp *InpxParser) SetArchiveMapping(mapping *MappingResolver) {
+	imp.resolvers = DefaultResolvers()
+	if mapping != nil {
+		imp.resolvers = append(imp.resolvers, mapping)
+	}
 }
 
 func (imp *InpxParser) readZipFile(zf *zip.File) ([]byte, error) {
@@ -38,7 +135,10 @@ func (imp *InpxParser) readZipFile(zf *zip.File) ([]byte, error) {
 	}
 	defer file.Close()
 	buf := bytes.NewBuffer(make([]byte, 0, zf.UncompressedSize64))
-	io.Copy(buf, file)
+	_, err = io.Copy(buf, file)
+	if err != nil {
+		return nil, err
+	}
 	return buf.Bytes(), nil
 }
 
@@ -58,103 +158,189 @@ func (imp *InpxParser) readZip() (*zip.Reader, func() error, error) {
 	return zipReader, file.Close, nil
 }
 
-func (imp *InpxParser) Parse(ctx context.Context) (map[string]entities.Book, error) {
-	log := logs.GetFromContext(ctx).With(zap.String("action", "parse_inpx"))
-	zipReader, closer, err := imp.readZip()
+func findZipFile(zipReader *zip.Reader, name string) *zip.File {
+	for _, zipFile := range zipReader.File {
+		if strings.EqualFold(zipFile.Name, name) {
+			return zipFile
+		}
+	}
+	return nil
+}
+
+// readStructure returns fields order declared in structure.info or the default one when the file is missing.
+func (imp *InpxParser) readStructure(ctx context.Context, zipReader *zip.Reader) (*inp.Structure, error) {
+	log := logs.GetFromContext(ctx)
+	zipFile := findZipFile(zipReader, structureInfo)
+	if zipFile == nil {
+		log.Debug("structure.info not found, using default structure")
+		return inp.DefaultStructure, nil
+	}
+	data, err := imp.readZipFile(zipFile)
 	if err != nil {
 		return nil, err
 	}
-	defer closer()
-	books := make(map[string]entities.Book)
-	// Read all the files from zip archive
-	for _, zipFile := range zipReader.File {
-		if !strings.HasSuffix(zipFile.Name, ".inp") {
-			log.Debug("skipping file", zap.String("filename", zipFile.Name))
-			continue
-		}
-		log.Debug("Reading file:", zap.String("filename", zipFile.Name))
-		unzippedFileBytes, err := imp.readZipFile(zipFile)
+	structure, err := inp.ParseStructure(data)
+	if err != nil {
+		return nil, err
+	}
+	log.Debug("structure.info found", zap.String("structure", structure.String()))
+	return structure, nil
+}
+
+// parseMember reads books of one inp file, broken records are returned as rejected.
+func (imp *InpxParser) parseMember(ctx context.Context, zipFile *zip.File, structure *inp.Structure, locator *archiveLocator) (memberResult, error) {
+	log := logs.GetFromContext(ctx).With(zap.String("member", zipFile.Name))
+	file, err := zipFile.Open()
+	if err != nil {
+		return memberResult{}, err
+	}
+	defer file.Close()
+	reader, encoding, err := inp.NewDecodingReader(file, imp.encoding)
+	if err != nil {
+		return memberResult{}, err
+	}
+	log.Debug("inp encoding", zap.Stringer("encoding", encoding))
+	metadata := entities.BookMetadata{Filepath: filepath.Join(imp.path)}
+	result := memberResult{
+		encoding: encoding,
+		books:    make([]entities.Book, 0, zipFile.UncompressedSize64/averageRecordSize),
+		rejected: make([]Rejected, 0),
+	}
+	missing := make(map[string]*MissingArchive)
+	for book, err := range inp.ParseBooks(ctx, reader, structure, metadata, imp.deleted) {
 		if err != nil {
-			return nil, err
-		}
-		metadata := entities.BookMetadata{
-			ArchiveName: zipFile.Name[:len(zipFile.Name)-3] + "zip",
-			Filepath:    filepath.Join(imp.path),
+			record, ok := newRejected(zipFile.Name, err)
+			if !ok {
+				return result, err
+			}
+			log.Debug("record rejected", zap.Int("line", record.Line), zap.Error(err))
+			result.rejected = append(result.rejected, record)
+			continue
 		}
-		err = inp.ParseBooksWithMetadataInplace(ctx, unzippedFileBytes, metadata, books)
-		if err != nil {
-			return nil, err
+		archive, tried, found := locator.locate(zipFile.Name, &book)
+		book.Metadata.ArchiveName = archive
+		if !found {
+			if _, ok := missing[archive]; !ok {
+				missing[archive] = &MissingArchive{Member: zipFile.Name, Archive: archive, Tried: tried}
+				result.missing = append(result.missing, missing[archive])
+			}
+			missing[archive].Books++
 		}
-		log.Debug("books parsed:", zap.Int("count", len(books)))
+		result.books = append(result.books, book)
 	}
-	return books, nil
+	for _, archive := range result.missing {
+		log.Warn("archive not found", zap.Error(archive))
+	}
+	return result, nil
 }
 
-func getProgress(total int, current int) int32 {
-	return int32(float64(current) / float64(total) * 100)
+func inpMembers(ctx context.Context, zipReader *zip.Reader) []*zip.File {
+	log := logs.GetFromContext(ctx)
+	members := make([]*zip.File, 0, len(zipReader.File))
+	for _, zipFile := range zipReader.File {
+		if !strings.HasSuffix(zipFile.Name, ".inp") {
+			log.Debug("skipping file", zap.String("filename", zipFile.Name))
+			continue
+		}
+		members = append(members, zipFile)
+	}
+	return members
 }
 
-func (imp *InpxParser) ParseSkipErrors(ctx context.Context) (map[string]entities.Book, error) {
+func (imp *InpxParser) parseInto(ctx context.Context, sink BookSink, skipErrors bool) (entities.Library, *ParseReport, error) {
 	imp.progress.Store(0)
 	defer imp.progress.Store(100)
 
-	log := logs.GetFromContext(ctx).With(zap.String("action", "parse_inpx_skip_errors"))
+	log := logs.GetFromContext(ctx)
 	zipReader, closer, err := imp.readZip()
 	if err != nil {
-		return nil, err
+		return entities.Library{}, nil, err
 	}
 	defer closer()
-	// Read all the files from zip archive
-	books := make(map[string]entities.Book)
-	total := len(zipReader.File)
-	for idx, zipFile := range zipReader.File {
-		if !strings.HasSuffix(zipFile.Name, ".inp") {
-			log.Debug("skipping file", zap.String("filename", zipFile.Name))
-			continue
-		}
-		log.Debug("reading file", zap.String("filename", zipFile.Name))
-		unzippedFileBytes, err := imp.readZipFile(zipFile)
-		if err != nil {
-			log.Error("error reading file from archive", zap.Error(err))
-			continue
-		}
-		metadata := entities.BookMetadata{
-			ArchiveName: zipFile.Name[:len(zipFile.Name)-3] + "zip",
-			Filepath:    filepath.Join(imp.path),
-		}
-		err = inp.ParseBooksWithMetadataInplace(ctx, unzippedFileBytes, metadata, books)
-		if err != nil {
-			return nil, err
-		}
-		imp.progress.Store(getProgress(total, idx+1))
+	structure, err := imp.readStructure(ctx, zipReader)
+	if err != nil {
+		log.Error("error reading structure.info", zap.Error(err))
+		return entities.Library{}, nil, err
 	}
-	log.Debug("books parsed:", zap.Int("count", len(books)))
-	return books, nil
+	library := imp.readLibrary(ctx, zipReader)
+	report := newParseReport()
+	locator := newArchiveLocator(imp.path, imp.resolvers)
+	err = imp.parseMembers(ctx, inpMembers(ctx, zipReader), structure, locator, sink, skipErrors, report)
+	if err != nil {
+		return entities.Library{}, nil, err
+	}
+	log.Debug("books parsed:", zap.Int("count", report.Books), zap.Int("rejected", report.Skipped()),
+		zap.Int("collisions", len(report.Collisions)))
+	return library, report, nil
+}
+
+// Parse reads the whole inpx, broken records are skipped and reported, but an unreadable inp file fails the parsing.
+func (imp *InpxParser) Parse(ctx context.Context) (map[string]entities.Book, entities.Library, *ParseReport, error) {
+	ctx = logs.WithLog(ctx, logs.GetFromContext(ctx), zap.String("action", "parse_inpx"))
+	books := make(mapSink)
+	library, report, err := imp.parseInto(ctx, books, false)
+	if err != nil {
+		return nil, entities.Library{}, nil, err
+	}
+	return books, library, report, nil
+}
+
+func getProgress(total int, current int) int32 {
+	return int32(float64(current) / float64(total) * 100)
+}
+
+func (imp *InpxParser) ParseSkipErrors(ctx context.Context) (map[string]entities.Book, entities.Library, *ParseReport, error) {
+	books := make(mapSink)
+	library, report, err := imp.ParseSkipErrorsInto(ctx, books)
+	if err != nil {
+		return nil, entities.Library{}, nil, err
+	}
+	return books, library, report, nil
+}
+
+// ParseSkipErrorsInto streams books into the sink without an intermediate map, broken records are reported.
+func (imp *InpxParser) ParseSkipErrorsInto(ctx context.Context, sink BookSink) (entities.Library, *ParseReport, error) {
+	ctx = logs.WithLog(ctx, logs.GetFromContext(ctx), zap.String("action", "parse_inpx_skip_errors"))
+	return imp.parseInto(ctx, sink, true)
 }
 
 func (imp *InpxParser) GetProgress() int {
 	return int(imp.progress.Load())
 }
 
-func (imp *InpxParser) ParseBooks(ctx context.Context, path string) (map[string]entities.Book, error) {
+func (imp *InpxParser) setPath(path string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	imp.path = filepath.Dir(path)
+	imp.filename = filepath.Base(path)
+	return nil
+}
+
+func (imp *InpxParser) ParseBooks(ctx context.Context, path string) (map[string]entities.Book, entities.Library, *ParseReport, error) {
+	books := make(mapSink)
+	library, report, err := imp.ParseBooksInto(ctx, path, books)
+	if err != nil {
+		return nil, entities.Library{}, nil, err
+	}
+	return books, library, report, nil
+}
+
+func (imp *InpxParser) ParseBooksInto(ctx context.Context, path string, sink BookSink) (entities.Library, *ParseReport, error) {
 	log := logs.GetFromContext(ctx).With(zap.String("action", "parse_inpx_skip_errors"))
 
-	path, err := filepath.Abs(path)
+	err := imp.setPath(path)
 	if err != nil {
 		log.Error("error getting absolute path", zap.Error(err))
-		return nil, err
+		return entities.Library{}, nil, err
 	}
-	dir := filepath.Dir(path)
-	filename := filepath.Base(path)
-
-	imp.path = dir
-	imp.filename = filename
 
-	books, err := imp.ParseSkipErrors(ctx)
+	library, report, err := imp.ParseSkipErrorsInto(ctx, sink)
 	if err != nil {
 		log.Error("error parsing books", zap.Error(err))
-		return nil, err
+		return entities.Library{}, nil, err
 	}
-	log.Debug("books parsed:", zap.Int("count", len(books)))
-	return books, nil
+	log.Debug("library parsed", zap.String("library", library.Title()), zap.Int("rejected", report.Skipped()))
+	return library, report, nil
 }
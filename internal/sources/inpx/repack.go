@@ -0,0 +1,172 @@
+package inpx
+
+import (
+	"archive/zip"
+	"cmp"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/HoskeOwl/PoorBookExtractor/internal/entities"
+)
+
+// repackArchiveBooks is the number of books in one archive of a repacked library.
+const repackArchiveBooks = 1000
+
+func repackArchiveName(first, last int) string {
+	return fmt.Sprintf("fb2-%06d-%06d.zip", first, last)
+}
+
+func bookEntryName(book *entities.Book) string {
+	return book.Filename + "." + book.Ext
+}
+
+type sourceArchive struct {
+	reader  *zip.ReadCloser
+	entries map[string]*zip.File
+}
+
+// sourceArchives keeps source archives of one output archive open.
+type sourceArchives map[string]*sourceArchive
+
+func (s sourceArchives) entry(book *entities.Book) (*zip.File, error) {
+	path := filepath.Join(book.Metadata.Filepath, book.Metadata.ArchiveName)
+	source, ok := s[path]
+	if !ok {
+		reader, err := zip.OpenReader(path)
+		if err != nil {
+			return nil, err
+		}
+		source = &sourceArchive{reader: reader, entries: make(map[string]*zip.File, len(reader.File))}
+		for _, entry := range reader.File {
+			source.entries[entry.Name] = entry
+		}
+		s[path] = source
+	}
+	name := bookEntryName(book)
+	entry, ok := source.entries[name]
+	if !ok {
+		return nil, fmt.Errorf("%s not found in %s: %w", name, path, os.ErrNotExist)
+	}
+	return entry, nil
+}
+
+func (s sourceArchives) Close() {
+	for path, source := range s {
+		source.reader.Close()
+		delete(s, path)
+	}
+}
+
+// copyEntry copies compressed data as is, so books are not recompressed.
+func copyEntry(zipWriter *zip.Writer, entry *zip.File, name string) error {
+	header := entry.FileHeader
+	header.Name = name
+	w, err := zipWriter.CreateRaw(&header)
+	if err != nil {
+		return err
+	}
+	raw, err := entry.OpenRaw()
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, raw)
+	return err
+}
+
+// repackArchive writes books into the new archive and returns them pointing to it, a partly written archive is removed.
+func repackArchive(dir, archive string, books []*entities.Book) ([]*entities.Book, error) {
+	path := filepath.Join(dir, archive)
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	zipWriter := zip.NewWriter(file)
+	repacked, err := copyBooks(zipWriter, dir, archive, books)
+	if err == nil {
+		err = zipWriter.Close()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+	return repacked, nil
+}
+
+func copyBooks(zipWriter *zip.Writer, dir, archive string, books []*entities.Book) ([]*entities.Book, error) {
+	sources := make(sourceArchives)
+	defer sources.Close()
+
+	repacked := make([]*entities.Book, 0, len(books))
+	names := make(map[string]bool, len(books))
+	for _, book := range books {
+		entry, err := sources.entry(book)
+		if err != nil {
+			return nil, err
+		}
+		copied := *book
+		copied.Source = ""
+		copied.Metadata = entities.BookMetadata{ArchiveName: archive, Filepath: dir}
+		// books of different libraries may have equal file names
+		for n := 2; names[bookEntryName(&copied)]; n++ {
+			copied.Filename = fmt.Sprintf("%s_%d", book.Filename, n)
+		}
+		names[bookEntryName(&copied)] = true
+		if err = copyEntry(zipWriter, entry, bookEntryName(&copied)); err != nil {
+			return nil, fmt.Errorf("copying %s: %w", entry.Name, err)
+		}
+		repacked = append(repacked, &copied)
+	}
+	return repacked, nil
+}
+
+/*
+RepackBooks builds a self-contained library in the directory: books are copied from their archives
+into new fb2-*.zip archives without recompression and the catalog is written as <library name>.inpx.
+Nothing is left in the directory when repacking fails.
+*/
+func RepackBooks(dir string, library entities.Library, books []*entities.Book) error {
+	if len(books) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	// books of one source archive go together, so every source is opened as rarely as possible
+	sorted := slices.Clone(books)
+	slices.SortStableFunc(sorted, func(a, b *entities.Book) int {
+		return cmp.Or(
+			cmp.Compare(a.Metadata.Filepath, b.Metadata.Filepath),
+			cmp.Compare(a.Metadata.ArchiveName, b.Metadata.ArchiveName),
+		)
+	})
+	repacked := make([]*entities.Book, 0, len(sorted))
+	archives := make([]string, 0, len(sorted)/repackArchiveBooks+1)
+	removeArchives := func() {
+		for _, archive := range archives {
+			os.Remove(filepath.Join(dir, archive))
+		}
+	}
+	for start := 0; start < len(sorted); start += repackArchiveBooks {
+		end := min(start+repackArchiveBooks, len(sorted))
+		archive := repackArchiveName(start+1, end)
+		archiveBooks, err := repackArchive(dir, archive, sorted[start:end])
+		if err != nil {
+			removeArchives()
+			return err
+		}
+		archives = append(archives, archive)
+		repacked = append(repacked, archiveBooks...)
+	}
+	// WriteInpx removes the catalog it failed to write
+	if err := WriteInpx(filepath.Join(dir, library.Name+".inpx"), library, repacked); err != nil {
+		removeArchives()
+		return err
+	}
+	return nil
+}
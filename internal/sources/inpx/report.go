@@ -0,0 +1,133 @@
+package inpx
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/HoskeOwl/PoorBookExtractor/internal/sources/inp"
+)
+
+// Rejected is an inp record skipped during parsing.
+type Rejected struct {
+	Member string
+	Line   int
+	Kind   error
+	Raw    string
+}
+
+func (r Rejected) Reason() string {
+	return r.Kind.Error()
+}
+
+// Record returns the raw record with fields separated by " | ".
+func (r Rejected) Record() string {
+	return strings.ReplaceAll(r.Raw, "\x04", " | ")
+}
+
+// MemberError is an inp file which could not be read till the end.
+type MemberError struct {
+	Member string
+	Err    error
+}
+
+// ParseReport collects diagnostics of the inpx parsing.
+type ParseReport struct {
+	Books    int
+	Rejected []Rejected
+	Failed   []MemberError
+	// Collisions are repeated LibIDs with the way they were resolved
+	Collisions []inp.Collision
+	// MissingArchives are archives of loaded books which were not found
+	MissingArchives []MissingArchive
+	// Encodings are detected (or forced) encodings of inp files
+	Encodings map[string]inp.Encoding
+}
+
+func newParseReport() *ParseReport {
+	return &ParseReport{Encodings: make(map[string]inp.Encoding)}
+}
+
+func newRejected(member string, err error) (Rejected, bool) {
+	var recordErr *inp.RecordError
+	if !errors.As(err, &recordErr) {
+		return Rejected{}, false
+	}
+	return Rejected{Member: member, Line: recordErr.Line, Kind: recordErr.Kind(), Raw: recordErr.Raw}, true
+}
+
+func (r *ParseReport) Skipped() int {
+	return len(r.Rejected)
+}
+
+// OverlappingArchives returns the number of collisions for every pair of archives sharing LibIDs.
+func (r *ParseReport) OverlappingArchives() map[[2]string]int {
+	counts := make(map[[2]string]int)
+	for _, collision := range r.Collisions {
+		counts[[2]string{collision.Existing, collision.Incoming}]++
+	}
+	return counts
+}
+
+// CountByEncoding returns number of inp files in every encoding.
+func (r *ParseReport) CountByEncoding() map[inp.Encoding]int {
+	counts := make(map[inp.Encoding]int)
+	for _, encoding := range r.Encodings {
+		counts[encoding]++
+	}
+	return counts
+}
+
+// EncodingSummary describes encodings of inp files, e.g. "windows-1251: 3 files, utf-8: 1 file".
+func (r *ParseReport) EncodingSummary() string {
+	counts := r.CountByEncoding()
+	parts := make([]string, 0, len(counts))
+	for _, encoding := range inp.Encodings {
+		count, ok := counts[encoding]
+		if !ok {
+			continue
+		}
+		files := "files"
+		if count == 1 {
+			files = "file"
+		}
+		parts = append(parts, fmt.Sprintf("%s: %d %s", encoding, count, files))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// CountByKind returns number of rejected records for every reason.
+func (r *ParseReport) CountByKind() map[string]int {
+	counts := make(map[string]int)
+	for _, rejected := range r.Rejected {
+		counts[rejected.Reason()]++
+	}
+	return counts
+}
+
+// SaveRejected writes all rejected records to a text file, one per line: file, line, reason and record separated by tabs.
+func (r *ParseReport) SaveRejected(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	for _, rejected := range r.Rejected {
+		if _, err = fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", rejected.Member, rejected.Line, rejected.Reason(), rejected.Record()); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return err
+	}
+	return nil
+}
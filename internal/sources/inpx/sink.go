@@ -0,0 +1,14 @@
+package inpx
+
+import "github.com/HoskeOwl/PoorBookExtractor/internal/entities"
+
+// BookSink receives parsed books one by one. A book with already known key (see entities.Book.Key) replaces the previous one.
+type BookSink interface {
+	AddBook(book *entities.Book)
+}
+
+type mapSink map[string]entities.Book
+
+func (s mapSink) AddBook(book *entities.Book) {
+	s[book.Key()] = *book
+}
@@ -0,0 +1,137 @@
+package inpx
+
+import (
+	"archive/zip"
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/HoskeOwl/PoorBookExtractor/internal/entities"
+	"github.com/HoskeOwl/PoorBookExtractor/internal/logs"
+	"github.com/HoskeOwl/PoorBookExtractor/internal/sources/inp"
+	"go.uber.org/zap"
+)
+
+type memberResult struct {
+	books    []entities.Book
+	rejected []Rejected
+	missing  []*MissingArchive
+	encoding inp.Encoding
+	err      error
+}
+
+// storeProgress never moves progress back, workers may finish out of order.
+func (imp *InpxParser) storeProgress(progress int32) {
+	for {
+		current := imp.progress.Load()
+		if current >= progress || imp.progress.CompareAndSwap(current, progress) {
+			return
+		}
+	}
+}
+
+/*
+parseMembers decompresses and parses inp files by a pool of workers.
+Results are merged into the sink in the order of files in the inpx, so repeated LibIDs are resolved
+by the duplicate policy exactly as with the sequential parsing. Only a window of workers*2 parsed files is kept in memory
+while waiting for a slow file, unless errors are not skipped: then all files are parsed before the sink gets any book.
+*/
+func (imp *InpxParser) parseMembers(ctx context.Context, members []*zip.File, structure *inp.Structure, locator *archiveLocator, sink BookSink, skipErrors bool, report *ParseReport) error {
+	log := logs.GetFromContext(ctx)
+	if len(members) == 0 {
+		return nil
+	}
+	workers := min(imp.workers, len(members))
+	ctx, cancel := context.WithCancel(ctx)
+	wg := sync.WaitGroup{}
+	defer wg.Wait()
+	defer cancel()
+
+	results := make([]chan memberResult, len(members))
+	for idx := range results {
+		results[idx] = make(chan memberResult, 1)
+	}
+	window := make(chan struct{}, workers*2)
+	jobs := make(chan int)
+	go func() {
+		defer close(jobs)
+		for idx := range members {
+			select {
+			case window <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case jobs <- idx:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	duplicates := inp.NewDuplicates(imp.duplicates)
+	defer func() { report.Collisions = duplicates.Collisions }()
+
+	parsed := atomic.Int32{}
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range jobs {
+				zipFile := members[idx]
+				log.Debug("reading file", zap.String("filename", zipFile.Name))
+				result, err := imp.parseMember(ctx, zipFile, structure, locator)
+				result.err = err
+				results[idx] <- result
+				imp.storeProgress(getProgress(len(members), int(parsed.Add(1))))
+			}
+		}()
+	}
+
+	// without skipping errors nothing reaches the sink until all files are parsed, so a failure leaves it untouched
+	pending := make([]memberResult, 0)
+	stored := 0
+	merge := func(member string, result memberResult) {
+		for bookIdx := range result.books {
+			if !duplicates.Resolve(&result.books[bookIdx]) {
+				continue
+			}
+			sink.AddBook(&result.books[bookIdx])
+			stored++
+		}
+		report.Rejected = append(report.Rejected, result.rejected...)
+		if result.err == nil {
+			report.Encodings[member] = result.encoding
+		}
+		for _, missing := range result.missing {
+			report.MissingArchives = append(report.MissingArchives, *missing)
+		}
+	}
+	for idx, zipFile := range members {
+		var result memberResult
+		select {
+		case result = <-results[idx]:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		<-window
+		if result.err != nil {
+			if !skipErrors {
+				return result.err
+			}
+			log.Error("error reading file from archive", zap.String("filename", zipFile.Name), zap.Error(result.err))
+			report.Failed = append(report.Failed, MemberError{Member: zipFile.Name, Err: result.err})
+		}
+		if !skipErrors {
+			pending = append(pending, result)
+			continue
+		}
+		merge(zipFile.Name, result)
+	}
+	for idx, result := range pending {
+		merge(members[idx].Name, result)
+	}
+	// books replacing loaded ones by KeepLast or KeepNewest are not new books
+	report.Books = stored - duplicates.Replaced()
+	return nil
+}
@@ -0,0 +1,146 @@
+package inpx
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/HoskeOwl/PoorBookExtractor/internal/entities"
+	"github.com/HoskeOwl/PoorBookExtractor/internal/logs"
+	"github.com/HoskeOwl/PoorBookExtractor/internal/sources/inp"
+	"go.uber.org/zap"
+)
+
+type countSink int
+
+func (s *countSink) AddBook(*entities.Book) {
+	*s++
+}
+
+// syntheticBooks makes a catalog of archives*perArchive books, every archive becomes one inp file.
+func syntheticBooks(archives, perArchive int) []*entities.Book {
+	books := make([]*entities.Book, 0, archives*perArchive)
+	for archive := range archives {
+		for n := range perArchive {
+			id := archive*perArchive + n + 1
+			books = append(books, &entities.Book{
+				Metadata:     entities.BookMetadata{ArchiveName: fmt.Sprintf("fb2-%06d.zip", archive+1)},
+				Authors:      []entities.Author{{Last: "Author" + strconv.Itoa(id%5000), First: "First" + strconv.Itoa(id%7), Middle: "Mid"}},
+				Genres:       []string{"sf", "prose_classic"},
+				Title:        "Title " + strconv.Itoa(id),
+				Series:       "Series" + strconv.Itoa(id%300),
+				SeriesNumber: strconv.Itoa(id % 12),
+				Filename:     strconv.Itoa(id),
+				Size:         int64(100000 + id),
+				LibID:        strconv.Itoa(id),
+				Ext:          "fb2",
+				Date:         time.Date(2015, 3, 2, 0, 0, 0, 0, time.UTC),
+				Lang:         "ru",
+				Rating:       id % 6,
+				Keywords:     []string{"kw"},
+			})
+		}
+	}
+	return books
+}
+
+func BenchmarkParseBooks(b *testing.B) {
+	path := filepath.Join(b.TempDir(), "synthetic.inpx")
+	books := syntheticBooks(64, 5000)
+	if err := WriteInpx(path, entities.Library{Name: "synthetic", ID: "synthetic"}, books); err != nil {
+		b.Fatal(err)
+	}
+	ctx := logs.WithLog(context.Background(), zap.NewNop())
+	// at least 4 workers, so the concurrent run differs from the sequential one on small machines
+	for _, workers := range []int{1, max(4, runtime.NumCPU())} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for b.Loop() {
+				var sink countSink
+				parser := NewInpxParser("", WithWorkers(workers))
+				if _, _, err := parser.ParseBooksInto(ctx, path, &sink); err != nil {
+					b.Fatal(err)
+				}
+				if int(sink) != len(books) {
+					b.Fatalf("parsed %d books, want %d", sink, len(books))
+				}
+			}
+		})
+	}
+}
+
+func TestParseBooksCountsNetBooks(t *testing.T) {
+	ctx := logs.WithLog(context.Background(), zap.NewNop())
+	path := filepath.Join(t.TempDir(), "duplicates.inpx")
+	books := syntheticBooks(2, 3)
+	// LibID 1 repeated in the second archive
+	repeated := *books[0]
+	repeated.Metadata.ArchiveName = books[len(books)-1].Metadata.ArchiveName
+	repeated.Filename = "repeated"
+	repeated.Date = repeated.Date.AddDate(1, 0, 0)
+	books = append(books, &repeated)
+	if err := WriteInpx(path, entities.Library{Name: "duplicates"}, books); err != nil {
+		t.Fatal(err)
+	}
+	for policy, want := range map[inp.DuplicatePolicy]int{inp.KeepLast: 6, inp.KeepFirst: 6, inp.KeepNewest: 6, inp.KeepBoth: 7} {
+		parsed, _, report, err := NewInpxParser("", WithDuplicatePolicy(policy)).ParseBooks(ctx, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(parsed) != want || report.Books != want {
+			t.Errorf("%s: got %d books, reported %d, want %d", policy, len(parsed), report.Books, want)
+		}
+	}
+}
+
+func TestParseLeavesSinkOnError(t *testing.T) {
+	ctx := logs.WithLog(context.Background(), zap.NewNop())
+	path := filepath.Join(t.TempDir(), "broken.inpx")
+	if err := WriteInpx(path, entities.Library{Name: "broken"}, syntheticBooks(1, 3)); err != nil {
+		t.Fatal(err)
+	}
+	// append an inp file failing its checksum after the good one
+	reader, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	zipWriter := zip.NewWriter(&buf)
+	for _, member := range reader.File {
+		if err := zipWriter.Copy(member); err != nil {
+			t.Fatal(err)
+		}
+	}
+	reader.Close()
+	w, err := zipWriter.CreateRaw(&zip.FileHeader{Name: "fb2-999999.inp", Method: zip.Store, CRC32: 1, CompressedSize64: 3, UncompressedSize64: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("bad")); err != nil {
+		t.Fatal(err)
+	}
+	if err := zipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var sink countSink
+	parser := NewInpxParser("")
+	if err := parser.setPath(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := parser.parseInto(ctx, &sink, false); err == nil {
+		t.Fatal("broken inp file is not reported")
+	}
+	if sink != 0 {
+		t.Errorf("sink got %d books of a failed parsing", sink)
+	}
+}
@@ -0,0 +1,135 @@
+package inpx
+
+import (
+	"archive/zip"
+	"cmp"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/HoskeOwl/PoorBookExtractor/internal/entities"
+	"github.com/HoskeOwl/PoorBookExtractor/internal/genres"
+	"github.com/HoskeOwl/PoorBookExtractor/internal/sources/inp"
+)
+
+// writeStructure is the default structure plus FOLDER, so readers don't have to guess archives by inp names.
+var writeStructure = inp.NewStructure(slices.Concat(inp.DefaultStructure.Fields(), []inp.Field{inp.FieldFolder}))
+
+// localCollectionType is the MyHomeLib type of a local fb2 collection.
+const localCollectionType = "0"
+
+func formatCollectionInfo(library entities.Library) string {
+	collectionType := library.Type
+	if collectionType == "" {
+		collectionType = localCollectionType
+	}
+	lines := []string{library.Name, library.ID, collectionType, library.Description, library.URL}
+	return strings.Join(lines, "\r\n") + "\r\n"
+}
+
+func formatVersionInfo(library entities.Library) string {
+	version := library.Version
+	if version == "" {
+		date := library.Date
+		if date.IsZero() {
+			date = time.Now()
+		}
+		version = date.Format("20060102")
+	}
+	return version + "\r\n"
+}
+
+// inpName is the inp file of the archive, the parser derives the archive back from it.
+func inpName(archive string) string {
+	return strings.TrimSuffix(archive, filepath.Ext(archive)) + ".inp"
+}
+
+func createZipFile(zipWriter *zip.Writer, name string) (io.Writer, error) {
+	return zipWriter.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+}
+
+func writeZipFile(zipWriter *zip.Writer, name string, data string) error {
+	w, err := createZipFile(zipWriter, name)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write([]byte(data))
+	return err
+}
+
+func writeInpx(zipWriter *zip.Writer, library entities.Library, books []*entities.Book) error {
+	if err := writeZipFile(zipWriter, collectionInfo, formatCollectionInfo(library)); err != nil {
+		return err
+	}
+	if err := writeZipFile(zipWriter, versionInfo, formatVersionInfo(library)); err != nil {
+		return err
+	}
+	if err := writeZipFile(zipWriter, structureInfo, writeStructure.String()+"\r\n"); err != nil {
+		return err
+	}
+	if len(library.Genres) > 0 {
+		if err := writeZipFile(zipWriter, "genres"+genreListExt, string(genres.FormatGlst(library.Genres))); err != nil {
+			return err
+		}
+	}
+	// archives of different roots may share the name, they are written as separate inp files
+	booksByArchive := make(map[entities.BookMetadata][]*entities.Book)
+	for _, book := range books {
+		booksByArchive[book.Metadata] = append(booksByArchive[book.Metadata], book)
+	}
+	archives := slices.SortedFunc(maps.Keys(booksByArchive), func(a, b entities.BookMetadata) int {
+		return cmp.Or(cmp.Compare(a.ArchiveName, b.ArchiveName), cmp.Compare(a.Filepath, b.Filepath))
+	})
+	names := make(map[string]bool, len(archives))
+	for _, archive := range archives {
+		name := memberName(archive.ArchiveName, names)
+		w, err := createZipFile(zipWriter, name)
+		if err != nil {
+			return err
+		}
+		if err = inp.WriteBooks(w, writeStructure, booksByArchive[archive]); err != nil {
+			return fmt.Errorf("writing %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// memberName returns an unused inp name of the archive, readers find the archive by the FOLDER column anyway.
+func memberName(archive string, used map[string]bool) string {
+	name := inpName(archive)
+	for n := 2; used[name]; n++ {
+		name = fmt.Sprintf("%s.%d.inp", strings.TrimSuffix(inpName(archive), ".inp"), n)
+	}
+	used[name] = true
+	return name
+}
+
+/*
+WriteInpx writes a catalog of the books, one inp file per archive.
+Archives are referenced by name only, so the catalog has to be placed next to them
+just like the original one.
+*/
+func WriteInpx(path string, library entities.Library, books []*entities.Book) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	zipWriter := zip.NewWriter(file)
+	err = writeInpx(zipWriter, library, books)
+	if err == nil {
+		err = zipWriter.Close()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package inpx
+
+import (
+	"archive/zip"
+	"context"
+	"io"
+	"maps"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/HoskeOwl/PoorBookExtractor/internal/entities"
+	"github.com/HoskeOwl/PoorBookExtractor/internal/logs"
+	"github.com/HoskeOwl/PoorBookExtractor/internal/sources/inp"
+	"go.uber.org/zap"
+)
+
+func readMember(t *testing.T, path, name string) string {
+	t.Helper()
+	reader, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	file, err := reader.Open(name)
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func members(t *testing.T, path string) []string {
+	t.Helper()
+	reader, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	names := make([]string, 0, len(reader.File))
+	for _, file := range reader.File {
+		names = append(names, file.Name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func TestWriteInpxRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "selection.inpx")
+	library := entities.Library{
+		Name:        "Selection",
+		ID:          "selection",
+		Type:        "0",
+		Description: "Selection from Test library",
+		URL:         "https://example.org",
+		Version:     "20240131",
+		Genres:      map[string]string{"sf_custom": "Своя фантастика"},
+	}
+	books := []*entities.Book{
+		{
+			Metadata:     entities.BookMetadata{ArchiveName: "fb2-000001-000002.zip", Filepath: "/library"},
+			Authors:      []entities.Author{{Last: "Стругацкий", First: "Аркадий", Middle: "Натанович"}, {Last: "Стругацкий", First: "Борис", Middle: "Натанович"}},
+			Genres:       []string{"sf", "sf_custom"},
+			Title:        "Пикник на обочине",
+			Series:       "Миры братьев Стругацких",
+			SeriesNumber: "3",
+			Filename:     "1",
+			Size:         250000,
+			LibID:        "1",
+			Ext:          "fb2",
+			Date:         time.Date(2015, 3, 2, 0, 0, 0, 0, time.UTC),
+			Lang:         "ru",
+			Rating:       5,
+			Keywords:     []string{"сталкер", "зона"},
+		},
+		{
+			Metadata: entities.BookMetadata{ArchiveName: "fb2-000001-000002.zip", Filepath: "/library"},
+			Authors:  []entities.Author{{Last: "Lem", First: "Stanisław"}},
+			Title:    "Solaris",
+			Filename: "2",
+			Size:     1,
+			LibID:    "2",
+			Deleted:  true,
+			Ext:      "epub",
+			Date:     time.Date(2001, 12, 31, 0, 0, 0, 0, time.UTC),
+			Lang:     "pl",
+		},
+		{
+			// another library with the same archive name
+			Metadata: entities.BookMetadata{ArchiveName: "fb2-000001-000002.zip", Filepath: "/other"},
+			Authors:  []entities.Author{{Last: "Толстой", First: "Лев"}},
+			Genres:   []string{"prose_classic"},
+			Title:    "Война и мир",
+			Filename: "3",
+			Size:     3000000,
+			LibID:    "3",
+			Ext:      "fb2",
+			Date:     time.Date(2010, 1, 1, 0, 0, 0, 0, time.UTC),
+			Lang:     "ru",
+		},
+	}
+	if err := WriteInpx(path, library, books); err != nil {
+		t.Fatal(err)
+	}
+
+	wantMembers := []string{collectionInfo, "fb2-000001-000002.2.inp", "fb2-000001-000002.inp", "genres" + genreListExt, structureInfo, versionInfo}
+	if got := members(t, path); !slices.Equal(got, wantMembers) {
+		t.Errorf("members: got %v, want %v", got, wantMembers)
+	}
+	if got := readMember(t, path, structureInfo); got != writeStructure.String()+"\r\n" {
+		t.Errorf("structure.info: got %q, want %q", got, writeStructure.String()+"\r\n")
+	}
+
+	parser := NewInpxParser("", WithDeletedMode(inp.IncludeDeleted))
+	parsed, gotLibrary, report, err := parser.ParseBooks(logs.WithLog(context.Background(), zap.NewNop()), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Skipped() != 0 {
+		t.Errorf("report: %d records skipped: %v", report.Skipped(), report.Rejected)
+	}
+	wantLibrary := library
+	wantLibrary.Date = time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)
+	if gotLibrary.Name != wantLibrary.Name || gotLibrary.ID != wantLibrary.ID || gotLibrary.Type != wantLibrary.Type ||
+		gotLibrary.Description != wantLibrary.Description || gotLibrary.URL != wantLibrary.URL ||
+		gotLibrary.Version != wantLibrary.Version || !gotLibrary.Date.Equal(wantLibrary.Date) ||
+		!maps.Equal(gotLibrary.Genres, wantLibrary.Genres) {
+		t.Errorf("library: got %+v, want %+v", gotLibrary, wantLibrary)
+	}
+
+	if len(parsed) != len(books) {
+		t.Errorf("got %d books, want %d", len(parsed), len(books))
+	}
+	for _, book := range books {
+		got, ok := parsed[book.Key()]
+		if !ok {
+			t.Errorf("book %s is not parsed", book.Key())
+			continue
+		}
+		// the parser finds archives next to the catalog by the FOLDER column
+		want := *book
+		want.Metadata.Filepath = dir
+		want.Folder = book.Metadata.ArchiveName
+		if !got.Equal(&want) {
+			t.Errorf("book %s:\ngot  %+v\nwant %+v", book.Key(), got, want)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"cmp"
+	"iter"
+	"maps"
+	"slices"
+
+	"github.com/HoskeOwl/PoorBookExtractor/internal/entities"
+)
+
+// FacetCounts are numbers of books per value of every facet.
+type FacetCounts map[entities.Facet]map[string]int
+
+func NewFacetCounts() FacetCounts {
+	counts := make(FacetCounts, len(entities.Facets))
+	for _, facet := range entities.Facets {
+		counts[facet] = make(map[string]int)
+	}
+	return counts
+}
+
+// Add counts the book, delta is 1 for an added book and -1 for a removed one.
+func (c FacetCounts) Add(book *entities.Book, delta int) {
+	for _, facet := range entities.Facets {
+		for _, value := range facet.Values(book) {
+			count := c[facet][value] + delta
+			if count <= 0 {
+				delete(c[facet], value)
+				continue
+			}
+			c[facet][value] = count
+		}
+	}
+}
+
+// Clone returns an independent copy.
+func (c FacetCounts) Clone() FacetCounts {
+	clone := make(FacetCounts, len(c))
+	for facet, counts := range c {
+		clone[facet] = maps.Clone(counts)
+	}
+	return clone
+}
+
+// Sorted returns values of the facet from the most frequent one, years go from the newest one.
+func (c FacetCounts) Sorted(facet entities.Facet) []string {
+	values := slices.Collect(maps.Keys(c[facet]))
+	slices.SortFunc(values, func(a, b string) int {
+		if facet == entities.YearFacet {
+			return cmp.Compare(b, a)
+		}
+		if c[facet][a] != c[facet][b] {
+			return c[facet][b] - c[facet][a]
+		}
+		return cmp.Compare(a, b)
+	})
+	return values
+}
+
+/*
+CountFacets counts facet values of books accepted by the filter.
+Values ticked in a facet don't narrow counts of the same facet,
+so other values of it show how many books ticking them would add.
+*/
+func CountFacets(books iter.Seq[*entities.Book], filter entities.BookFilter) FacetCounts {
+	counts := NewFacetCounts()
+	filters := make(map[entities.Facet]entities.BookFilter, len(entities.Facets))
+	for _, facet := range entities.Facets {
+		filters[facet] = filter.Select(facet, nil)
+	}
+	for book := range books {
+		for _, facet := range entities.Facets {
+			if !filters[facet].Accept(book) {
+				continue
+			}
+			for _, value := range facet.Values(book) {
+				counts[facet][value]++
+			}
+		}
+	}
+	return counts
+}
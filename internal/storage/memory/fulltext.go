@@ -0,0 +1,227 @@
+package memory
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/HoskeOwl/PoorBookExtractor/internal/collation"
+	"github.com/HoskeOwl/PoorBookExtractor/internal/entities"
+	"github.com/HoskeOwl/PoorBookExtractor/internal/storage"
+)
+
+// TextField is a book field covered by the full-text index, a token may come from several fields.
+type TextField uint8
+
+const (
+	TitleField TextField = 1 << iota
+	SeriesField
+	KeywordsField
+)
+
+// weight ranks a match in the title above series and series above keywords.
+func (f TextField) weight() float64 {
+	switch {
+	case f&TitleField != 0:
+		return 3
+	case f&SeriesField != 0:
+		return 2
+	case f&KeywordsField != 0:
+		return 1
+	}
+	return 0
+}
+
+const (
+	// prefixWeight lowers the score of a token which only starts with the query term
+	prefixWeight = 0.5
+	// minPrefixLen is the shortest term which matches tokens by prefix, shorter ones match whole tokens only
+	minPrefixLen = 3
+)
+
+type posting struct {
+	book   *entities.Book
+	fields TextField
+}
+
+// textIndex maps normalized tokens of titles, series and keywords to books.
+type textIndex struct {
+	postings map[string][]posting
+}
+
+func newTextIndex(books map[string]*entities.Book) *textIndex {
+	ti := &textIndex{postings: make(map[string][]posting)}
+	for _, book := range books {
+		ti.add(book)
+	}
+	return ti
+}
+
+func (ti *textIndex) add(book *entities.Book) {
+	for token, fields := range bookTokens(book) {
+		ti.postings[token] = append(ti.postings[token], posting{book: book, fields: fields})
+	}
+}
+
+// remove drops books at once, so tokens shared by many books are filtered only once.
+func (ti *textIndex) remove(books ...*entities.Book) {
+	removed := make(map[*entities.Book]struct{}, len(books))
+	tokens := make(map[string]struct{})
+	for _, book := range books {
+		removed[book] = struct{}{}
+		for token := range bookTokens(book) {
+			tokens[token] = struct{}{}
+		}
+	}
+	for token := range tokens {
+		postings := slices.DeleteFunc(ti.postings[token], func(p posting) bool {
+			_, ok := removed[p.book]
+			return ok
+		})
+		if len(postings) == 0 {
+			delete(ti.postings, token)
+			continue
+		}
+		ti.postings[token] = postings
+	}
+}
+
+func bookTokens(book *entities.Book) map[string]TextField {
+	tokens := make(map[string]TextField)
+	for _, token := range Tokenize(book.Title) {
+		tokens[token] |= TitleField
+	}
+	for _, token := range Tokenize(book.Series) {
+		tokens[token] |= SeriesField
+	}
+	for _, keyword := range book.Keywords {
+		for _, token := range Tokenize(keyword) {
+			tokens[token] |= KeywordsField
+		}
+	}
+	return tokens
+}
+
+// Tokenize splits the text into lower case words of letters and digits, ё is folded into е.
+func Tokenize(text string) []string {
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for idx, word := range words {
+		words[idx] = strings.Map(func(r rune) rune {
+			r = unicode.ToLower(r)
+			if r == 'ё' {
+				return 'е'
+			}
+			return r
+		}, word)
+	}
+	return words
+}
+
+/*
+ParseTextQuery splits the query into groups of terms: all terms of a group must match (AND),
+groups are alternatives (OR) separated by "OR" or "|", e.g.
+"гарри поттер | hobbit" is (гарри AND поттер) OR hobbit.
+*/
+func ParseTextQuery(query string) [][]string {
+	groups := make([][]string, 0)
+	group := make([]string, 0)
+	for _, word := range strings.Fields(strings.ReplaceAll(query, "|", " | ")) {
+		if word == "OR" || word == "|" {
+			if len(group) > 0 {
+				groups = append(groups, group)
+			}
+			group = make([]string, 0)
+			continue
+		}
+		group = append(group, Tokenize(word)...)
+	}
+	if len(group) > 0 {
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+// match scores books containing the term, whole tokens are preferred to tokens starting with the term.
+func (ti *textIndex) match(term string) map[*entities.Book]float64 {
+	scores := make(map[*entities.Book]float64)
+	collect := func(postings []posting, factor float64) {
+		for _, p := range postings {
+			score := p.fields.weight() * factor
+			if score > scores[p.book] {
+				scores[p.book] = score
+			}
+		}
+	}
+	collect(ti.postings[term], 1)
+	if len([]rune(term)) < minPrefixLen {
+		return scores
+	}
+	for token, postings := range ti.postings {
+		if token != term && strings.HasPrefix(token, term) {
+			collect(postings, prefixWeight)
+		}
+	}
+	return scores
+}
+
+// search returns books matching all terms, rare terms weigh more than frequent ones.
+func (ti *textIndex) search(terms []string, total int) map[*entities.Book]float64 {
+	var result map[*entities.Book]float64
+	for _, term := range terms {
+		scores := ti.match(term)
+		idf := math.Log(1 + float64(total)/float64(len(scores)+1))
+		if result == nil {
+			result = make(map[*entities.Book]float64, len(scores))
+			for book, score := range scores {
+				result[book] = score * idf
+			}
+			continue
+		}
+		for book, score := range result {
+			termScore, ok := scores[book]
+			if !ok {
+				delete(result, book)
+				continue
+			}
+			result[book] = score + termScore*idf
+		}
+		if len(result) == 0 {
+			break
+		}
+	}
+	return result
+}
+
+// SearchBooks finds books by words of titles, series and keywords (see ParseTextQuery) ordered from the best match.
+// The index is built on the first search and kept up to date afterwards.
+func (ms *MemoryStorage) SearchBooks(text string, filter entities.BookFilter) []storage.BookMatch {
+	groups := ParseTextQuery(text)
+	if len(groups) == 0 {
+		return nil
+	}
+	if ms.text == nil {
+		ms.text = newTextIndex(ms.books)
+	}
+	scores := make(map[*entities.Book]float64)
+	for _, group := range groups {
+		for book, score := range ms.text.search(group, len(ms.books)) {
+			scores[book] += score
+		}
+	}
+	matches := make([]storage.BookMatch, 0, len(scores))
+	for book, score := range scores {
+		if filter.Accept(book) {
+			matches = append(matches, storage.BookMatch{Book: book, Score: score})
+		}
+	}
+	// equal scores keep the collator order of books
+	collation.SortFunc(ms.collator, matches, func(match storage.BookMatch) string { return match.Book.Title })
+	slices.SortStableFunc(matches, func(a, b storage.BookMatch) int {
+		return cmp.Compare(b.Score, a.Score)
+	})
+	return matches
+}
@@ -0,0 +1,162 @@
+package memory
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/HoskeOwl/PoorBookExtractor/internal/collation"
+	"github.com/HoskeOwl/PoorBookExtractor/internal/entities"
+	"github.com/HoskeOwl/PoorBookExtractor/internal/search"
+)
+
+const (
+	// transliterationScore is the score of a word spelled in other way, words spelled as the name part score 1
+	transliterationScore = 0.98
+	// prefixScore is the score of a word the name part starts with
+	prefixScore = 0.95
+	// containsScore is the score of a word found inside the name part
+	containsScore = 0.9
+)
+
+type namePart struct {
+	author string
+	// folded is the word as written (see search.Fold), key is its transliteration key
+	folded   string
+	key      string
+	trigrams int
+}
+
+// nameIndex keeps transliteration keys (see search.Key) of author name parts with their trigrams.
+type nameIndex struct {
+	parts    []namePart
+	postings map[string][]int32
+}
+
+func newNameIndex(authors map[string]entities.Author) *nameIndex {
+	ni := &nameIndex{parts: make([]namePart, 0, len(authors)*3), postings: make(map[string][]int32)}
+	for key, author := range authors {
+		for _, part := range author.Parts() {
+			for _, word := range strings.Fields(part) {
+				partKey := search.Key(word)
+				if partKey == "" {
+					continue
+				}
+				trigrams := search.Trigrams(partKey)
+				id := int32(len(ni.parts))
+				ni.parts = append(ni.parts, namePart{author: key, folded: search.Fold(word), key: partKey, trigrams: len(trigrams)})
+				for _, trigram := range trigrams {
+					ni.postings[trigram] = append(ni.postings[trigram], id)
+				}
+			}
+		}
+	}
+	return ni
+}
+
+// match returns the best score of the word among name parts of every matching author.
+func (ni *nameIndex) match(word string, threshold float64) map[string]float64 {
+	scores := make(map[string]float64)
+	keep := func(author string, score float64) {
+		if score > scores[author] {
+			scores[author] = score
+		}
+	}
+	key := search.Key(word)
+	if key == "" {
+		return scores
+	}
+	folded := search.Fold(word)
+	for _, part := range ni.parts {
+		switch {
+		case part.folded == folded:
+			keep(part.author, 1)
+		case part.key == key:
+			keep(part.author, transliterationScore)
+		case strings.HasPrefix(part.key, key):
+			keep(part.author, prefixScore)
+		case strings.Contains(part.key, key):
+			keep(part.author, containsScore)
+		}
+	}
+	if utf8.RuneCountInString(key) < search.MinFuzzyLen {
+		return scores
+	}
+	trigrams := search.Trigrams(key)
+	shared := make(map[int32]int)
+	for _, trigram := range trigrams {
+		for _, id := range ni.postings[trigram] {
+			shared[id]++
+		}
+	}
+	for id, count := range shared {
+		part := ni.parts[id]
+		if part.key == key {
+			// scored above, the same key doesn't make a typo
+			continue
+		}
+		if score := search.Jaccard(count, len(trigrams), part.trigrams); score >= threshold {
+			keep(part.author, score)
+		}
+	}
+	return scores
+}
+
+// nameKey returns the transliteration key of the author name, queries match names by it (see query.Query.UseNameKeys).
+func (ms *MemoryStorage) nameKey(author entities.Author) string {
+	key, ok := ms.nameKeys[author]
+	if !ok {
+		key = search.Key(author.String())
+		ms.nameKeys[author] = key
+	}
+	return key
+}
+
+type authorMatch struct {
+	key   string
+	score float64
+}
+
+/*
+findAuthors ranks authors by similarity of their names to the value: every word must match some part of the name
+exactly, as a beginning, inside it or by trigram similarity not lower than search.DefaultThreshold.
+Names are compared by transliteration keys, so Cyrillic and Latin spellings find each other.
+*/
+func (ms *MemoryStorage) findAuthors(value string, filter entities.BookFilter) []string {
+	if ms.names == nil {
+		ms.names = newNameIndex(ms.authors)
+	}
+	var total map[string]float64
+	words := strings.Fields(value)
+	for _, word := range words {
+		scores := ms.names.match(word, search.DefaultThreshold)
+		if total == nil {
+			total = scores
+			continue
+		}
+		for author, score := range total {
+			wordScore, ok := scores[author]
+			if !ok {
+				delete(total, author)
+				continue
+			}
+			total[author] = score + wordScore
+		}
+	}
+	matches := make([]authorMatch, 0, len(total))
+	for author, score := range total {
+		if hasAccepted(ms.byAuthor[author], filter) {
+			matches = append(matches, authorMatch{key: author, score: score / float64(len(words))})
+		}
+	}
+	collation.SortFunc(ms.collator, matches, func(match authorMatch) string { return match.key })
+	slices.SortStableFunc(matches, func(a, b authorMatch) int {
+		return cmp.Compare(b.score, a.score)
+	})
+	authors := make([]string, 0, len(matches))
+	for _, match := range matches {
+		authors = append(authors, match.key)
+	}
+	return authors
+}
@@ -0,0 +1,86 @@
+package memory
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/HoskeOwl/PoorBookExtractor/internal/entities"
+)
+
+func (ms *MemoryStorage) addToSeries(book *entities.Book) {
+	key := book.SeriesKey()
+	if key == "" {
+		return
+	}
+	if _, ok := ms.series[key]; !ok {
+		ms.series[key] = strings.TrimSpace(book.Series)
+	}
+	ms.bySeries[key] = append(ms.bySeries[key], book)
+}
+
+func (ms *MemoryStorage) removeFromSeries(book *entities.Book) {
+	key := book.SeriesKey()
+	if key == "" {
+		return
+	}
+	books := slices.DeleteFunc(ms.bySeries[key], func(b *entities.Book) bool {
+		return b == book
+	})
+	if len(books) == 0 {
+		delete(ms.bySeries, key)
+		delete(ms.series, key)
+		return
+	}
+	ms.bySeries[key] = books
+}
+
+// GetSeriesName returns the series name as it is written in the first added book.
+func (ms *MemoryStorage) GetSeriesName(key string) (string, bool) {
+	name, ok := ms.series[key]
+	return name, ok
+}
+
+// GetSeriesFiltered returns keys of series with all words of the value in their names, all series for empty value.
+// Only series with at least one book accepted by the filter are returned.
+func (ms *MemoryStorage) GetSeriesFiltered(value string, filter entities.BookFilter) []string {
+	tokens := strings.Fields(strings.ToLower(value))
+	keys := make([]string, 0)
+	for key, books := range ms.bySeries {
+		if !hasAccepted(books, filter) {
+			continue
+		}
+		matched := true
+		for _, token := range tokens {
+			if !strings.Contains(key, token) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			keys = append(keys, key)
+		}
+	}
+	ms.collator.Sort(keys)
+	return keys
+}
+
+// GetSeriesBooks returns books of the series by number in it, books with one number go by title.
+func (ms *MemoryStorage) GetSeriesBooks(key string) []*entities.Book {
+	return ms.GetSeriesBooksFiltered(key, entities.BookFilter{})
+}
+
+// GetSeriesBooksFiltered ignores the book order (see SetBookOrder), a series is always read by numbers.
+func (ms *MemoryStorage) GetSeriesBooksFiltered(key string, filter entities.BookFilter) []*entities.Book {
+	books := make([]*entities.Book, 0, len(ms.bySeries[key]))
+	for _, book := range ms.bySeries[key] {
+		if filter.Accept(book) {
+			books = append(books, book)
+		}
+	}
+	ms.collator.SortBooks(books, entities.BySeries)
+	return books
+}
+
+func (ms *MemoryStorage) SeriesLen() int {
+	return len(ms.bySeries)
+}
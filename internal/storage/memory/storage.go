@@ -6,59 +6,258 @@ import (
 	"slices"
 	"strings"
 
+	"github.com/HoskeOwl/PoorBookExtractor/internal/collation"
 	"github.com/HoskeOwl/PoorBookExtractor/internal/entities"
+	"github.com/HoskeOwl/PoorBookExtractor/internal/query"
+	"github.com/HoskeOwl/PoorBookExtractor/internal/storage"
 )
 
+// MemoryStorage is the in-memory storage.Storage, it indexes books by book key (see entities.Book.Key) and by author key (see entities.Author.Key).
 type MemoryStorage struct {
 	books    map[string]*entities.Book
 	byAuthor map[string][]*entities.Book
+	authors  map[string]entities.Author
+	// bySeries lists books by series key (see entities.Book.SeriesKey), series keeps names of series
+	bySeries map[string][]*entities.Book
+	series   map[string]string
+	// facets counts all books per facet value
+	facets storage.FacetCounts
+	// text is the full-text index, nil until the first search
+	text *textIndex
+	// names is the author name index, nil until the first search and after authors change
+	names *nameIndex
+	// nameKeys are transliteration keys of author names for queries, nil until the first query and after authors change
+	nameKeys map[entities.Author]string
+	// collator orders authors, series and books, sortedAuthors are author keys in its order, nil after authors change
+	collator      *collation.Collator
+	sortedAuthors []string
+	// bookOrder is the order of books of authors, series are always ordered by number
+	bookOrder entities.BookOrder
 }
 
+var _ storage.Storage = (*MemoryStorage)(nil)
+
 func NewMemoryStorage(books []*entities.Book) *MemoryStorage {
-	booksMap := make(map[string]*entities.Book)
-	byAuthor := make(map[string][]*entities.Book)
+	ms := &MemoryStorage{collator: collation.New(collation.English)}
+	ms.Clear()
 	for _, book := range books {
-		for _, author := range book.Authors {
-			byAuthor[author] = append(byAuthor[author], book)
-		}
-		booksMap[book.LibID] = book
+		ms.AddBook(book)
 	}
-	return &MemoryStorage{books: booksMap, byAuthor: byAuthor}
+	return ms
 }
 
+// AddBook adds the book or replaces the stored one with the same key.
 func (ms *MemoryStorage) AddBook(book *entities.Book) {
-	ms.books[book.LibID] = book
+	key := book.Key()
+	if old, ok := ms.books[key]; ok {
+		ms.removeFromAuthors(old)
+		ms.removeFromSeries(old)
+		ms.facets.Add(old, -1)
+		if ms.text != nil {
+			ms.text.remove(old)
+		}
+	}
+	ms.books[key] = book
+	ms.addToSeries(book)
+	ms.facets.Add(book, 1)
+	if ms.text != nil {
+		ms.text.add(book)
+	}
+	for _, author := range book.Authors {
+		key := author.Key()
+		if _, ok := ms.authors[key]; !ok {
+			ms.authors[key] = author
+			ms.authorsChanged()
+		}
+		ms.byAuthor[key] = append(ms.byAuthor[key], book)
+	}
+}
+
+// RemoveBook removes the book by key and reports whether it was stored.
+func (ms *MemoryStorage) RemoveBook(key string) (*entities.Book, bool) {
+	book, ok := ms.books[key]
+	if !ok {
+		return nil, false
+	}
+	ms.removeFromAuthors(book)
+	ms.removeFromSeries(book)
+	ms.facets.Add(book, -1)
+	delete(ms.books, key)
+	if ms.text != nil {
+		ms.text.remove(book)
+	}
+	return book, true
+}
+
+// RemoveSource removes all books of the library and returns their number.
+func (ms *MemoryStorage) RemoveSource(source string) int {
+	removed := make([]*entities.Book, 0)
+	for key, book := range ms.books {
+		if book.Source != source {
+			continue
+		}
+		ms.removeFromAuthors(book)
+		ms.removeFromSeries(book)
+		ms.facets.Add(book, -1)
+		delete(ms.books, key)
+		removed = append(removed, book)
+	}
+	if ms.text != nil {
+		ms.text.remove(removed...)
+	}
+	return len(removed)
+}
+
+func (ms *MemoryStorage) removeFromAuthors(book *entities.Book) {
 	for _, author := range book.Authors {
-		ms.byAuthor[author] = append(ms.byAuthor[author], book)
+		key := author.Key()
+		books := slices.DeleteFunc(ms.byAuthor[key], func(b *entities.Book) bool {
+			return b == book
+		})
+		if len(books) == 0 {
+			delete(ms.byAuthor, key)
+			delete(ms.authors, key)
+			ms.authorsChanged()
+			continue
+		}
+		ms.byAuthor[key] = books
+	}
+}
+
+// ExportSource returns books of the library with their author index.
+func (ms *MemoryStorage) ExportSource(source string) ([]*entities.Book, []storage.AuthorIndex) {
+	books := ms.SourceBooks(source)
+	positions := make(map[*entities.Book]int, len(books))
+	for idx, book := range books {
+		positions[book] = idx
+	}
+	authors := make([]storage.AuthorIndex, 0)
+	for key, authorBooks := range ms.byAuthor {
+		index := storage.AuthorIndex{Key: key, Author: ms.authors[key]}
+		for _, book := range authorBooks {
+			if idx, ok := positions[book]; ok {
+				index.Books = append(index.Books, idx)
+			}
+		}
+		if len(index.Books) > 0 {
+			authors = append(authors, index)
+		}
+	}
+	return books, authors
+}
+
+// AddIndexed adds books with the prepared author index (see ExportSource), keys of books must not be stored yet.
+func (ms *MemoryStorage) AddIndexed(books []entities.Book, authors []storage.AuthorIndex) {
+	if len(ms.books) == 0 {
+		// an empty storage is allocated at once instead of growing book by book
+		ms.books = make(map[string]*entities.Book, len(books))
+		ms.byAuthor = make(map[string][]*entities.Book, len(authors))
+		ms.authors = make(map[string]entities.Author, len(authors))
+	}
+	for idx := range books {
+		ms.books[books[idx].Key()] = &books[idx]
+		ms.addToSeries(&books[idx])
+		ms.facets.Add(&books[idx], 1)
+		if ms.text != nil {
+			ms.text.add(&books[idx])
+		}
+	}
+	for _, index := range authors {
+		if _, ok := ms.authors[index.Key]; !ok {
+			ms.authors[index.Key] = index.Author
+			ms.authorsChanged()
+		}
+		authorBooks := ms.byAuthor[index.Key]
+		if authorBooks == nil {
+			authorBooks = make([]*entities.Book, 0, len(index.Books))
+		}
+		for _, idx := range index.Books {
+			authorBooks = append(authorBooks, &books[idx])
+		}
+		ms.byAuthor[index.Key] = authorBooks
 	}
 }
 
+// SourceBooks returns all books of the library.
+func (ms *MemoryStorage) SourceBooks(source string) []*entities.Book {
+	books := make([]*entities.Book, 0)
+	for _, book := range ms.books {
+		if book.Source == source {
+			books = append(books, book)
+		}
+	}
+	return books
+}
+
 func (ms *MemoryStorage) GetAuthors(value string) []string {
-	if value == "" {
-		keys := slices.Collect(maps.Keys(ms.byAuthor))
-		slices.Sort(keys)
-		return keys
+	return ms.GetAuthorsFiltered(value, entities.BookFilter{})
+}
+
+func hasAccepted(books []*entities.Book, filter entities.BookFilter) bool {
+	if filter.IsEmpty() {
+		return true
 	}
-	value = strings.ToLower(value)
-	tokens := strings.Split(value, " ")
-	authors := make([]string, 0)
-	for author := range ms.byAuthor {
-		lowerAuthor := strings.ToLower(author)
-		found := true
-		for _, token := range tokens {
-			found = found && strings.Contains(lowerAuthor, token)
+	return slices.ContainsFunc(books, filter.Accept)
+}
+
+// GetAuthorsFiltered returns authors which have at least one book accepted by the filter.
+// All authors are ordered by key with the collator, found ones from the most similar (see findAuthors).
+func (ms *MemoryStorage) GetAuthorsFiltered(value string, filter entities.BookFilter) []string {
+	if strings.TrimSpace(value) != "" {
+		return ms.findAuthors(value, filter)
+	}
+	keys := make([]string, 0, len(ms.byAuthor))
+	for _, author := range ms.authorOrder() {
+		if hasAccepted(ms.byAuthor[author], filter) {
+			keys = append(keys, author)
 		}
-		if found {
-			authors = append(authors, author)
+	}
+	return keys
+}
+
+// QueryBooks returns books matching the query and accepted by the filter.
+func (ms *MemoryStorage) QueryBooks(q *query.Query, filter entities.BookFilter) []*entities.Book {
+	if ms.nameKeys == nil {
+		ms.nameKeys = make(map[entities.Author]string)
+	}
+	q.UseNameKeys(ms.nameKey)
+	books := make([]*entities.Book, 0)
+	for _, book := range ms.books {
+		if filter.Accept(book) && q.Match(book) {
+			books = append(books, book)
 		}
 	}
-	slices.Sort(authors)
-	slices.Reverse(authors)
-	return authors
+	return books
+}
+
+// FacetCounts counts books accepted by the filter per facet value, counts of all books are kept up to date.
+func (ms *MemoryStorage) FacetCounts(filter entities.BookFilter) storage.FacetCounts {
+	if filter.IsEmpty() {
+		return ms.facets.Clone()
+	}
+	return storage.CountFacets(maps.Values(ms.books), filter)
 }
 
+func (ms *MemoryStorage) GetAuthor(key string) (entities.Author, bool) {
+	author, ok := ms.authors[key]
+	return author, ok
+}
+
+// GetAuthorBooks returns books of the author in the book order (see SetBookOrder).
 func (ms *MemoryStorage) GetAuthorBooks(author string) []*entities.Book {
-	return ms.byAuthor[author]
+	return ms.GetAuthorBooksFiltered(author, entities.BookFilter{})
+}
+
+func (ms *MemoryStorage) GetAuthorBooksFiltered(author string, filter entities.BookFilter) []*entities.Book {
+	books := ms.byAuthor[author]
+	filtered := make([]*entities.Book, 0, len(books))
+	for _, book := range books {
+		if filter.Accept(book) {
+			filtered = append(filtered, book)
+		}
+	}
+	ms.collator.SortBooks(filtered, ms.bookOrder)
+	return filtered
 }
 
 func (ms *MemoryStorage) GetBooks(book_ids []string) []*entities.Book {
@@ -76,13 +275,43 @@ func (ms *MemoryStorage) GetBooks(book_ids []string) []*entities.Book {
 func (ms *MemoryStorage) Clear() {
 	ms.books = make(map[string]*entities.Book)
 	ms.byAuthor = make(map[string][]*entities.Book)
+	ms.authors = make(map[string]entities.Author)
+	ms.bySeries = make(map[string][]*entities.Book)
+	ms.series = make(map[string]string)
+	ms.facets = storage.NewFacetCounts()
+	ms.text = nil
+	ms.authorsChanged()
+}
+
+// SetCollator changes the order of authors, series and books, it is English by default.
+func (ms *MemoryStorage) SetCollator(collator *collation.Collator) {
+	ms.collator = collator
+	ms.sortedAuthors = nil
+}
+
+// SetBookOrder changes the order of books of authors, it is entities.BySeries by default.
+func (ms *MemoryStorage) SetBookOrder(order entities.BookOrder) {
+	ms.bookOrder = order
+}
+
+func (ms *MemoryStorage) authorsChanged() {
+	ms.names = nil
+	ms.nameKeys = nil
+	ms.sortedAuthors = nil
+}
+
+// authorOrder returns all author keys in the collator order, the slice is shared and must not be changed.
+func (ms *MemoryStorage) authorOrder() []string {
+	if ms.sortedAuthors == nil {
+		ms.sortedAuthors = slices.Collect(maps.Keys(ms.byAuthor))
+		ms.collator.Sort(ms.sortedAuthors)
+	}
+	return ms.sortedAuthors
 }
 
 func (ms *MemoryStorage) IterBooksByAuthor() iter.Seq2[string, []*entities.Book] {
 	return func(yield func(author string, book []*entities.Book) bool) {
-		authors := slices.Collect(maps.Keys(ms.byAuthor))
-		slices.Sort(authors)
-		for _, author := range authors {
+		for _, author := range ms.authorOrder() {
 			books := ms.byAuthor[author]
 			if !yield(author, books) {
 				return
@@ -99,16 +328,14 @@ func (ms *MemoryStorage) BooksLen() int {
 	return len(ms.books)
 }
 
-func (ms *MemoryStorage) GetBook(libID string) (*entities.Book, bool) {
-	book, ok := ms.books[libID]
+func (ms *MemoryStorage) GetBook(key string) (*entities.Book, bool) {
+	book, ok := ms.books[key]
 	return book, ok
 }
 
 func (ms *MemoryStorage) IterByAuthors() iter.Seq[string] {
 	return func(yield func(author string) bool) {
-		authors := slices.Collect(maps.Keys(ms.byAuthor))
-		slices.Sort(authors)
-		for _, author := range authors {
+		for _, author := range ms.authorOrder() {
 			if !yield(author) {
 				return
 			}
@@ -0,0 +1,13 @@
+package memory_test
+
+import (
+	"testing"
+
+	"github.com/HoskeOwl/PoorBookExtractor/internal/storage"
+	"github.com/HoskeOwl/PoorBookExtractor/internal/storage/memory"
+	"github.com/HoskeOwl/PoorBookExtractor/internal/storage/storagetest"
+)
+
+func TestStorage(t *testing.T) {
+	storagetest.Run(t, func() storage.Storage { return memory.NewMemoryStorage(nil) })
+}
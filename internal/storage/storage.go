@@ -0,0 +1,86 @@
+// Package storage declares what the application needs from a book storage, backends live in subpackages.
+package storage
+
+import (
+	"iter"
+
+	"github.com/HoskeOwl/PoorBookExtractor/internal/collation"
+	"github.com/HoskeOwl/PoorBookExtractor/internal/entities"
+	"github.com/HoskeOwl/PoorBookExtractor/internal/query"
+)
+
+/*
+Storage keeps books of all loaded libraries indexed by book key (see entities.Book.Key)
+and by author key (see entities.Author.Key).
+Implementations aren't required to be safe for concurrent use, storagetest.Run checks the behavior all of them share.
+*/
+type Storage interface {
+	// AddBook adds the book or replaces the stored one with the same key.
+	AddBook(book *entities.Book)
+	// AddIndexed adds books with the prepared author index (see ExportSource), keys of books must not be stored yet.
+	AddIndexed(books []entities.Book, authors []AuthorIndex)
+	// RemoveBook removes the book by key and reports whether it was stored.
+	RemoveBook(key string) (*entities.Book, bool)
+	// RemoveSource removes all books of the library and returns their number.
+	RemoveSource(source string) int
+	// SourceBooks returns all books of the library.
+	SourceBooks(source string) []*entities.Book
+	// ExportSource returns books of the library with their author index.
+	ExportSource(source string) ([]*entities.Book, []AuthorIndex)
+
+	GetAuthor(key string) (entities.Author, bool)
+	// GetAuthors returns keys of authors with all words of the value in their names ordered from the most similar,
+	// all authors ordered by key with the collator for empty value. Words match in any transliteration and with typos.
+	GetAuthors(value string) []string
+	// GetAuthorsFiltered is GetAuthors limited to authors with at least one book accepted by the filter.
+	GetAuthorsFiltered(value string, filter entities.BookFilter) []string
+	// GetAuthorBooks returns books of the author in the book order (see SetBookOrder).
+	GetAuthorBooks(author string) []*entities.Book
+	GetAuthorBooksFiltered(author string, filter entities.BookFilter) []*entities.Book
+
+	// GetSeriesName returns the name of the series by key (see entities.Book.SeriesKey).
+	GetSeriesName(key string) (string, bool)
+	// GetSeriesFiltered returns keys of series with all words of the value in their names, all series for empty value.
+	GetSeriesFiltered(value string, filter entities.BookFilter) []string
+	// GetSeriesBooks returns books of the series by number in it whatever the book order is, books with one number go by title.
+	GetSeriesBooks(key string) []*entities.Book
+	GetSeriesBooksFiltered(key string, filter entities.BookFilter) []*entities.Book
+
+	GetBook(key string) (*entities.Book, bool)
+	// GetBooks returns stored books in order of keys skipping unknown ones.
+	GetBooks(keys []string) []*entities.Book
+	// SearchBooks finds books by words of titles, series and keywords ordered from the best match.
+	SearchBooks(text string, filter entities.BookFilter) []BookMatch
+	// QueryBooks returns books matching the query and accepted by the filter.
+	QueryBooks(q *query.Query, filter entities.BookFilter) []*entities.Book
+
+	// FacetCounts counts books accepted by the filter per value of every facet (see CountFacets).
+	FacetCounts(filter entities.BookFilter) FacetCounts
+
+	// SetCollator changes the order of author keys, series keys and books.
+	SetCollator(collator *collation.Collator)
+	// SetBookOrder changes the order of books of authors, entities.BySeries until it is set.
+	SetBookOrder(order entities.BookOrder)
+	// IterBooksByAuthor yields authors ordered by key with their books.
+	IterBooksByAuthor() iter.Seq2[string, []*entities.Book]
+	// IterByAuthors yields author keys in order.
+	IterByAuthors() iter.Seq[string]
+	AuthorsLen() int
+	SeriesLen() int
+	BooksLen() int
+	// Clear removes all books.
+	Clear()
+}
+
+// AuthorIndex lists books of the author by positions in a books slice, it lets cached libraries skip indexing.
+type AuthorIndex struct {
+	Key    string
+	Author entities.Author
+	Books  []int
+}
+
+// BookMatch is a book found by the full-text search, a higher score is a better match.
+type BookMatch struct {
+	Book  *entities.Book
+	Score float64
+}
@@ -0,0 +1,494 @@
+/*
+Package storagetest is the conformance suite of storage.Storage backends.
+A backend runs it from its own tests:
+
+	func TestStorage(t *testing.T) {
+		storagetest.Run(t, func() storage.Storage { return memory.NewMemoryStorage(nil) })
+	}
+*/
+package storagetest
+
+import (
+	"maps"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/HoskeOwl/PoorBookExtractor/internal/collation"
+	"github.com/HoskeOwl/PoorBookExtractor/internal/entities"
+	"github.com/HoskeOwl/PoorBookExtractor/internal/query"
+	"github.com/HoskeOwl/PoorBookExtractor/internal/storage"
+)
+
+// Run checks the behavior every backend shares, newStorage must return an empty storage on every call.
+func Run(t *testing.T, newStorage func() storage.Storage) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, s storage.Storage)
+	}{
+		{"AddAndGet", testAddAndGet},
+		{"Replace", testReplace},
+		{"Authors", testAuthors},
+		{"FindAuthors", testFindAuthors},
+		{"FuzzyAuthors", testFuzzyAuthors},
+		{"Filter", testFilter},
+		{"Series", testSeries},
+		{"Collation", testCollation},
+		{"BookOrder", testBookOrder},
+		{"Facets", testFacets},
+		{"Remove", testRemove},
+		{"RemoveSource", testRemoveSource},
+		{"ExportSource", testExportSource},
+		{"SearchBooks", testSearchBooks},
+		{"QueryBooks", testQueryBooks},
+		{"Iterate", testIterate},
+		{"Clear", testClear},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newStorage()
+			if s.BooksLen() != 0 || s.AuthorsLen() != 0 {
+				t.Fatalf("new storage has %d books and %d authors", s.BooksLen(), s.AuthorsLen())
+			}
+			tt.test(t, s)
+		})
+	}
+
+	t.Run("AddIndexed", func(t *testing.T) {
+		source := newStorage()
+		addSample(source)
+		books, authors := source.ExportSource("1")
+		copied := make([]entities.Book, 0, len(books))
+		for _, book := range books {
+			copied = append(copied, *book)
+		}
+		target := newStorage()
+		target.AddIndexed(copied, authors)
+		checkKeys(t, "books", bookKeys(target.SourceBooks("1")), bookKeys(source.SourceBooks("1")))
+		checkKeys(t, "authors", slices.Collect(target.IterByAuthors()), []string{"стругацкий,аркадий", "стругацкий,борис", "толстой,лев"})
+		checkKeys(t, "author books", bookKeys(target.GetAuthorBooks("толстой,лев")), []string{"1#1"})
+		checkKeys(t, "search after indexed", matchKeys(target.SearchBooks("пикник", entities.BookFilter{})), []string{"1#2"})
+	})
+}
+
+func newBook(source, libID, title, series string, authors ...string) *entities.Book {
+	book := &entities.Book{
+		Source: source,
+		LibID:  libID,
+		Title:  title,
+		Series: series,
+		Lang:   "ru",
+		Ext:    "fb2",
+		Size:   1 << 20,
+		Date:   time.Date(2015, 3, 2, 0, 0, 0, 0, time.UTC),
+	}
+	for _, author := range authors {
+		book.Authors = append(book.Authors, entities.ParseAuthor(author))
+	}
+	return book
+}
+
+// addSample fills the storage with books of two libraries, keys are "1#1", "1#2", "1#3" and "2#1".
+func addSample(s storage.Storage) {
+	war := newBook("1", "1", "Война и мир", "", "Толстой,Лев")
+	war.Rating = 5
+	war.Keywords = []string{"роман"}
+	picnic := newBook("1", "2", "Пикник на обочине", "", "Стругацкий,Аркадий", "Стругацкий,Борис")
+	picnic.Rating = 4
+	noon := newBook("1", "3", "Полдень, XXII век", "Мир Полудня", "Стругацкий,Аркадий", "Стругацкий,Борис")
+	noon.SeriesNumber = "1"
+	noon.Date = time.Date(2010, 1, 1, 0, 0, 0, 0, time.UTC)
+	noon.Size = 3 << 20
+	other := newBook("2", "1", "Ёжик в тумане", "", "Козлов,Сергей")
+	other.Genres = []string{"child_tale"}
+	for _, book := range []*entities.Book{war, picnic, noon, other} {
+		s.AddBook(book)
+	}
+}
+
+func bookKeys(books []*entities.Book) []string {
+	keys := make([]string, 0, len(books))
+	for _, book := range books {
+		keys = append(keys, book.Key())
+	}
+	return keys
+}
+
+func matchKeys(matches []storage.BookMatch) []string {
+	keys := make([]string, 0, len(matches))
+	for _, match := range matches {
+		keys = append(keys, match.Book.Key())
+	}
+	return keys
+}
+
+// checkKeys compares keys ignoring their order.
+func checkKeys(t *testing.T, what string, got, want []string) {
+	t.Helper()
+	got = slices.Sorted(slices.Values(got))
+	want = slices.Sorted(slices.Values(want))
+	if !slices.Equal(got, want) {
+		t.Errorf("%s: got %v, want %v", what, got, want)
+	}
+}
+
+func testAddAndGet(t *testing.T, s storage.Storage) {
+	addSample(s)
+	if s.BooksLen() != 4 {
+		t.Errorf("BooksLen: got %d, want 4", s.BooksLen())
+	}
+	book, ok := s.GetBook("1#2")
+	if !ok || book.Title != "Пикник на обочине" {
+		t.Fatalf("GetBook(1#2): got %v, %v", book, ok)
+	}
+	if _, ok := s.GetBook("1"); ok {
+		t.Error("GetBook found a book by LibID without the source")
+	}
+	got := bookKeys(s.GetBooks([]string{"2#1", "missing", "1#1"}))
+	if !slices.Equal(got, []string{"2#1", "1#1"}) {
+		t.Errorf("GetBooks: got %v, want [2#1 1#1] in order of keys", got)
+	}
+}
+
+func testReplace(t *testing.T, s storage.Storage) {
+	addSample(s)
+	replaced := newBook("1", "1", "Анна Каренина", "", "Tolstoy,Leo")
+	s.AddBook(replaced)
+	if s.BooksLen() != 4 {
+		t.Errorf("BooksLen: got %d, want 4", s.BooksLen())
+	}
+	if book, _ := s.GetBook("1#1"); book.Title != "Анна Каренина" {
+		t.Errorf("GetBook: got %q, want the replacing book", book.Title)
+	}
+	if _, ok := s.GetAuthor("толстой,лев"); ok {
+		t.Error("author without books is still stored")
+	}
+	checkKeys(t, "replacing author books", bookKeys(s.GetAuthorBooks("tolstoy,leo")), []string{"1#1"})
+	checkKeys(t, "search replaced", matchKeys(s.SearchBooks("война", entities.BookFilter{})), nil)
+	checkKeys(t, "search replacing", matchKeys(s.SearchBooks("каренина", entities.BookFilter{})), []string{"1#1"})
+}
+
+func testAuthors(t *testing.T, s storage.Storage) {
+	addSample(s)
+	s.AddBook(newBook("2", "2", "Трудно быть богом", "", "СТРУГАЦКИЙ,АРКАДИЙ"))
+	if s.AuthorsLen() != 4 {
+		t.Errorf("AuthorsLen: got %d, want 4, names in other case are the same author", s.AuthorsLen())
+	}
+	author, ok := s.GetAuthor("стругацкий,аркадий")
+	if !ok || author.Last != "Стругацкий" {
+		t.Errorf("GetAuthor: got %v, %v, want the first spelling", author, ok)
+	}
+	checkKeys(t, "author books", bookKeys(s.GetAuthorBooks("стругацкий,аркадий")), []string{"1#2", "1#3", "2#2"})
+	checkKeys(t, "unknown author books", bookKeys(s.GetAuthorBooks("unknown")), nil)
+}
+
+func testFindAuthors(t *testing.T, s storage.Storage) {
+	addSample(s)
+	all := s.GetAuthors("")
+	want := []string{"козлов,сергей", "стругацкий,аркадий", "стругацкий,борис", "толстой,лев"}
+	if !slices.Equal(all, want) {
+		t.Errorf("GetAuthors(\"\"): got %v, want sorted %v", all, want)
+	}
+	checkKeys(t, "one word", s.GetAuthors("стругацкий"), []string{"стругацкий,аркадий", "стругацкий,борис"})
+	checkKeys(t, "words in any order", s.GetAuthors("Бор Струг"), []string{"стругацкий,борис"})
+	checkKeys(t, "no match", s.GetAuthors("пушкин"), nil)
+}
+
+func testFuzzyAuthors(t *testing.T, s storage.Storage) {
+	addSample(s)
+	s.AddBook(newBook("2", "2", "Улитка на склоне", "", "Стругацкий,Аркадий,Натанович"))
+	s.AddBook(newBook("2", "3", "Сказка о тройке", "", "Струговщиков,Александр"))
+	s.AddBook(newBook("2", "4", "Roadside Picnic", "", "Strugatsky,Arkady"))
+	brothers := []string{"стругацкий,аркадий", "стругацкий,аркадий,натанович", "стругацкий,борис", "strugatsky,arkady"}
+	for _, spelling := range []string{"Стругацкий", "Strugatsky", "Strugackij", "Strugatskii", "стругацкии", "Strugaski"} {
+		checkKeys(t, spelling, s.GetAuthors(spelling), brothers)
+	}
+	checkKeys(t, "ё folding and transliterated first name", s.GetAuthors("Arkadij Стругацкий"),
+		[]string{"стругацкий,аркадий", "стругацкий,аркадий,натанович", "strugatsky,arkady"})
+	checkKeys(t, "diacritics", s.GetAuthors("Kozlóv Sergéj"), []string{"козлов,сергей"})
+	got := s.GetAuthors("Аркадий Стругацкий")
+	if len(got) != 3 || got[0] != "стругацкий,аркадий" && got[0] != "стругацкий,аркадий,натанович" {
+		t.Errorf("ranking: got %v, want exact Cyrillic spellings first", got)
+	}
+	checkKeys(t, "unrelated name", s.GetAuthors("Tolkien"), nil)
+}
+
+func testFilter(t *testing.T, s storage.Storage) {
+	addSample(s)
+	rated := entities.BookFilter{MinRating: 5}
+	checkKeys(t, "authors by rating", s.GetAuthorsFiltered("", rated), []string{"толстой,лев"})
+	checkKeys(t, "authors by source", s.GetAuthorsFiltered("", entities.BookFilter{Source: "2"}), []string{"козлов,сергей"})
+	checkKeys(t, "author books by rating",
+		bookKeys(s.GetAuthorBooksFiltered("стругацкий,борис", entities.BookFilter{MinRating: 4})), []string{"1#2"})
+	checkKeys(t, "author books without filter",
+		bookKeys(s.GetAuthorBooksFiltered("стругацкий,борис", entities.BookFilter{})), []string{"1#2", "1#3"})
+}
+
+func testSeries(t *testing.T, s storage.Storage) {
+	addSample(s)
+	second := newBook("2", "2", "Трудно быть богом", "мир полудня", "Стругацкий,Аркадий")
+	second.SeriesNumber = "10"
+	s.AddBook(second)
+	third := newBook("2", "3", "Обитаемый остров", "Мир Полудня", "Стругацкий,Борис")
+	third.SeriesNumber = "9"
+	s.AddBook(third)
+	if s.SeriesLen() != 1 {
+		t.Errorf("SeriesLen: got %d, want 1, books out of series and names in other case don't add series", s.SeriesLen())
+	}
+	if name, ok := s.GetSeriesName("мир полудня"); !ok || name != "Мир Полудня" {
+		t.Errorf("GetSeriesName: got %q, %v, want the first spelling", name, ok)
+	}
+	if got := bookKeys(s.GetSeriesBooks("мир полудня")); !slices.Equal(got, []string{"1#3", "2#3", "2#2"}) {
+		t.Errorf("GetSeriesBooks: got %v, want [1#3 2#3 2#2] ordered by number", got)
+	}
+	checkKeys(t, "filtered series books",
+		bookKeys(s.GetSeriesBooksFiltered("мир полудня", entities.BookFilter{Source: "2"})), []string{"2#2", "2#3"})
+	checkKeys(t, "all series", s.GetSeriesFiltered("", entities.BookFilter{}), []string{"мир полудня"})
+	checkKeys(t, "series by words", s.GetSeriesFiltered("Полуд мир", entities.BookFilter{}), []string{"мир полудня"})
+	checkKeys(t, "series by rating", s.GetSeriesFiltered("", entities.BookFilter{MinRating: 5}), nil)
+	for _, key := range []string{"1#3", "2#2", "2#3"} {
+		s.RemoveBook(key)
+	}
+	if _, ok := s.GetSeriesName("мир полудня"); ok || s.SeriesLen() != 0 {
+		t.Error("series without books is still stored")
+	}
+}
+
+func testCollation(t *testing.T, s storage.Storage) {
+	for i, author := range []string{"Жуков,Юрий", "Ёлкин,Иван", "Ежов,Николай", "Zweig,Stefan", "Åberg,Lars", "Abbott,Edwin"} {
+		s.AddBook(newBook("1", strconv.Itoa(i), "Книга", "", author))
+	}
+	for i, title := range []string{"Ель", "Ёжик", "Второй", "Десятый"} {
+		book := newBook("2", strconv.Itoa(i), title, "Мир", "Ежов,Николай")
+		book.SeriesNumber = map[string]string{"Второй": "2", "Десятый": "10"}[title]
+		s.AddBook(book)
+	}
+	s.AddBook(newBook("2", "4", "Книга", "Zeta", "Ежов,Николай"))
+	s.AddBook(newBook("2", "5", "Книга", "Ёлки", "Ежов,Николай"))
+
+	s.SetCollator(collation.New(collation.English))
+	want := []string{"abbott,edwin", "åberg,lars", "zweig,stefan", "ежов,николай", "ёлкин,иван", "жуков,юрий"}
+	if got := s.GetAuthors(""); !slices.Equal(got, want) {
+		t.Errorf("English GetAuthors: got %v, want %v", got, want)
+	}
+	s.SetCollator(collation.New(collation.Russian))
+	want = []string{"ежов,николай", "ёлкин,иван", "жуков,юрий", "abbott,edwin", "åberg,lars", "zweig,stefan"}
+	if got := s.GetAuthors(""); !slices.Equal(got, want) {
+		t.Errorf("Russian GetAuthors: got %v, want %v", got, want)
+	}
+	if got := slices.Collect(s.IterByAuthors()); !slices.Equal(got, want) {
+		t.Errorf("Russian IterByAuthors: got %v, want %v", got, want)
+	}
+	if got := s.GetSeriesFiltered("", entities.BookFilter{}); !slices.Equal(got, []string{"ёлки", "мир", "zeta"}) {
+		t.Errorf("Russian GetSeriesFiltered: got %v, want [ёлки мир zeta]", got)
+	}
+	// numbered books go first, the rest by title with ё sorted as е
+	if got := bookKeys(s.GetSeriesBooks("мир")); !slices.Equal(got, []string{"2#2", "2#3", "2#1", "2#0"}) {
+		t.Errorf("GetSeriesBooks: got %v, want [2#2 2#3 2#1 2#0]", got)
+	}
+}
+
+func testBookOrder(t *testing.T, s storage.Storage) {
+	books := []struct {
+		title, series, number string
+		year                  int
+		size                  int64
+		rating                int
+	}{
+		{"Ёжик", "", "", 2001, 3, 0},
+		{"Война", "Мир", "2", 2010, 1, 4},
+		{"Альфа", "Мир", "1", 2005, 2, 5},
+		{"Бета", "", "", 2020, 4, 3},
+	}
+	for i, b := range books {
+		book := newBook("1", strconv.Itoa(i), b.title, b.series, "Толстой,Лев")
+		book.SeriesNumber = b.number
+		book.Date = time.Date(b.year, 1, 1, 0, 0, 0, 0, time.UTC)
+		book.Size = b.size
+		book.Rating = b.rating
+		s.AddBook(book)
+	}
+	for order, want := range map[entities.BookOrder][]string{
+		entities.BySeries: {"1#2", "1#1", "1#3", "1#0"},
+		entities.ByTitle:  {"1#2", "1#3", "1#1", "1#0"},
+		entities.ByNewest: {"1#3", "1#1", "1#2", "1#0"},
+		entities.BySize:   {"1#3", "1#0", "1#2", "1#1"},
+		entities.ByRating: {"1#2", "1#1", "1#3", "1#0"},
+	} {
+		s.SetBookOrder(order)
+		if got := bookKeys(s.GetAuthorBooks("толстой,лев")); !slices.Equal(got, want) {
+			t.Errorf("GetAuthorBooks by %s: got %v, want %v", order, got, want)
+		}
+		if got := bookKeys(s.GetAuthorBooksFiltered("толстой,лев", entities.BookFilter{MinRating: 4})); !slices.Equal(got, slices.DeleteFunc(slices.Clone(want), func(key string) bool {
+			return key == "1#3" || key == "1#0"
+		})) {
+			t.Errorf("GetAuthorBooksFiltered by %s: got %v", order, got)
+		}
+	}
+	// a series is read by numbers whatever the book order is, books with one number go by title
+	tie := newBook("1", "4", "Аврора", "Мир", "Толстой,Лев")
+	tie.SeriesNumber = "2"
+	tie.Date = time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.AddBook(tie)
+	for _, order := range entities.BookOrders {
+		s.SetBookOrder(order)
+		if got := bookKeys(s.GetSeriesBooks("мир")); !slices.Equal(got, []string{"1#2", "1#4", "1#1"}) {
+			t.Errorf("GetSeriesBooks by %s: got %v, want [1#2 1#4 1#1]", order, got)
+		}
+	}
+}
+
+func testFacets(t *testing.T, s storage.Storage) {
+	addSample(s)
+	english := newBook("2", "2", "Roadside Picnic", "", "Strugatsky,Arkady")
+	english.Lang = "EN"
+	english.Genres = []string{"sf", "child_tale"}
+	s.AddBook(english)
+	check := func(what string, counts storage.FacetCounts, facet entities.Facet, want map[string]int) {
+		t.Helper()
+		if !maps.Equal(counts[facet], want) {
+			t.Errorf("%s %s: got %v, want %v", what, facet, counts[facet], want)
+		}
+	}
+	all := s.FacetCounts(entities.BookFilter{})
+	check("all", all, entities.LangFacet, map[string]int{"ru": 4, "en": 1})
+	check("all", all, entities.GenreFacet, map[string]int{"sf": 1, "child_tale": 2})
+	check("all", all, entities.YearFacet, map[string]int{"2015": 4, "2010": 1})
+
+	filter := entities.BookFilter{Langs: []string{"ru"}}
+	narrowed := s.FacetCounts(filter)
+	check("ru", narrowed, entities.GenreFacet, map[string]int{"child_tale": 1})
+	check("ru", narrowed, entities.YearFacet, map[string]int{"2015": 3, "2010": 1})
+	// other languages show how many books ticking them adds
+	check("ru", narrowed, entities.LangFacet, map[string]int{"ru": 4, "en": 1})
+	checkKeys(t, "authors of ru child_tale",
+		s.GetAuthorsFiltered("", filter.Select(entities.GenreFacet, []string{"child_tale"})), []string{"козлов,сергей"})
+
+	s.RemoveBook("2#2")
+	check("after removal", s.FacetCounts(entities.BookFilter{}), entities.LangFacet, map[string]int{"ru": 4})
+}
+
+func testRemove(t *testing.T, s storage.Storage) {
+	addSample(s)
+	book, ok := s.RemoveBook("1#1")
+	if !ok || book.LibID != "1" {
+		t.Fatalf("RemoveBook: got %v, %v", book, ok)
+	}
+	if _, ok := s.RemoveBook("1#1"); ok {
+		t.Error("RemoveBook removed the book twice")
+	}
+	if s.BooksLen() != 3 || s.AuthorsLen() != 3 {
+		t.Errorf("got %d books and %d authors, want 3 and 3", s.BooksLen(), s.AuthorsLen())
+	}
+	checkKeys(t, "search removed", matchKeys(s.SearchBooks("война", entities.BookFilter{})), nil)
+	s.RemoveBook("1#2")
+	checkKeys(t, "co-author books", bookKeys(s.GetAuthorBooks("стругацкий,борис")), []string{"1#3"})
+}
+
+func testRemoveSource(t *testing.T, s storage.Storage) {
+	addSample(s)
+	checkKeys(t, "source books", bookKeys(s.SourceBooks("1")), []string{"1#1", "1#2", "1#3"})
+	if removed := s.RemoveSource("1"); removed != 3 {
+		t.Errorf("RemoveSource: got %d, want 3", removed)
+	}
+	checkKeys(t, "authors left", s.GetAuthors(""), []string{"козлов,сергей"})
+	checkKeys(t, "source books after removal", bookKeys(s.SourceBooks("1")), nil)
+	if removed := s.RemoveSource("1"); removed != 0 {
+		t.Errorf("RemoveSource of removed library: got %d, want 0", removed)
+	}
+}
+
+func testExportSource(t *testing.T, s storage.Storage) {
+	addSample(s)
+	books, authors := s.ExportSource("1")
+	checkKeys(t, "exported books", bookKeys(books), []string{"1#1", "1#2", "1#3"})
+	for _, author := range authors {
+		if author.Key != author.Author.Key() {
+			t.Errorf("author index key %q doesn't match %v", author.Key, author.Author)
+		}
+		for _, idx := range author.Books {
+			if idx < 0 || idx >= len(books) {
+				t.Fatalf("author %q refers to book %d of %d", author.Key, idx, len(books))
+			}
+		}
+	}
+	if len(authors) != 3 {
+		t.Errorf("exported authors: got %d, want 3", len(authors))
+	}
+}
+
+func testSearchBooks(t *testing.T, s storage.Storage) {
+	addSample(s)
+	none := entities.BookFilter{}
+	checkKeys(t, "title word", matchKeys(s.SearchBooks("пикник", none)), []string{"1#2"})
+	checkKeys(t, "all words", matchKeys(s.SearchBooks("пикник война", none)), nil)
+	checkKeys(t, "alternatives", matchKeys(s.SearchBooks("пикник OR война", none)), []string{"1#1", "1#2"})
+	checkKeys(t, "ё folding", matchKeys(s.SearchBooks("ежик", none)), []string{"2#1"})
+	checkKeys(t, "keywords", matchKeys(s.SearchBooks("роман", none)), []string{"1#1"})
+	checkKeys(t, "filtered", matchKeys(s.SearchBooks("пикник OR война", entities.BookFilter{MinRating: 5})), []string{"1#1"})
+	// "мир" is in the title of one book and in the series of another one
+	matches := s.SearchBooks("мир", none)
+	if got := matchKeys(matches); !slices.Equal(got, []string{"1#1", "1#3"}) {
+		t.Errorf("ranking: got %v, want the title match before the series match", got)
+	}
+	if len(s.SearchBooks("", none)) != 0 {
+		t.Error("empty search found books")
+	}
+}
+
+func testQueryBooks(t *testing.T, s storage.Storage) {
+	addSample(s)
+	run := func(text string) []string {
+		t.Helper()
+		q, err := query.Parse(text)
+		if err != nil {
+			t.Fatalf("Parse(%q): %s", text, err)
+		}
+		return bookKeys(s.QueryBooks(q, entities.BookFilter{}))
+	}
+	checkKeys(t, "author", run("author:стругацкий"), []string{"1#2", "1#3"})
+	checkKeys(t, "transliterated author", run("author:strugatsky"), []string{"1#2", "1#3"})
+	checkKeys(t, "transliterated author pattern", run("author=strug*ky*"), []string{"1#2", "1#3"})
+	checkKeys(t, "date and size", run("date<2015 size>=2MB"), []string{"1#3"})
+	checkKeys(t, "empty series", run(`-series:""`), []string{"1#3"})
+	checkKeys(t, "genre wildcard", run("genre:child_*"), []string{"2#1"})
+	q, _ := query.Parse("lang:ru")
+	checkKeys(t, "filtered", bookKeys(s.QueryBooks(q, entities.BookFilter{Source: "2"})), []string{"2#1"})
+}
+
+func testIterate(t *testing.T, s storage.Storage) {
+	addSample(s)
+	want := []string{"козлов,сергей", "стругацкий,аркадий", "стругацкий,борис", "толстой,лев"}
+	if got := slices.Collect(s.IterByAuthors()); !slices.Equal(got, want) {
+		t.Errorf("IterByAuthors: got %v, want %v", got, want)
+	}
+	got := make([]string, 0)
+	books := 0
+	for author, authorBooks := range s.IterBooksByAuthor() {
+		got = append(got, author)
+		books += len(authorBooks)
+	}
+	// books of co-authors are yielded for each of them
+	if !slices.Equal(got, want) || books != 6 {
+		t.Errorf("IterBooksByAuthor: got %v with %d books, want %v with 6", got, books, want)
+	}
+	for range s.IterByAuthors() {
+		// stopping early must be safe
+		break
+	}
+}
+
+func testClear(t *testing.T, s storage.Storage) {
+	addSample(s)
+	s.SearchBooks("мир", entities.BookFilter{})
+	s.Clear()
+	if s.BooksLen() != 0 || s.AuthorsLen() != 0 {
+		t.Errorf("got %d books and %d authors after Clear", s.BooksLen(), s.AuthorsLen())
+	}
+	checkKeys(t, "search after Clear", matchKeys(s.SearchBooks("мир", entities.BookFilter{})), nil)
+	addSample(s)
+	if s.BooksLen() != 4 {
+		t.Errorf("BooksLen after refill: got %d, want 4", s.BooksLen())
+	}
+}
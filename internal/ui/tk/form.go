@@ -6,6 +6,10 @@ import (
 	"runtime"
 
 	"github.com/HoskeOwl/PoorBookExtractor/internal/app"
+	"github.com/HoskeOwl/PoorBookExtractor/internal/collation"
+	"github.com/HoskeOwl/PoorBookExtractor/internal/entities"
+	"github.com/HoskeOwl/PoorBookExtractor/internal/genres"
+	"github.com/HoskeOwl/PoorBookExtractor/internal/sources/inp"
 	"go.uber.org/zap"
 	. "modernc.org/tk9.0"
 	_ "modernc.org/tk9.0/themes/azure"
@@ -21,7 +25,25 @@ type MainForm struct {
 	ResultList *TTreeviewWidget
 	Statusbar  *LabelWidget
 
-	FindValue *Opt
+	FindValue   *Opt
+	DeletedMode *TComboboxWidget
+	MinRating   *TSpinboxWidget
+	BookOrder   *TComboboxWidget
+	Library     *TComboboxWidget
+	SearchIn    *TComboboxWidget
+	// libraryIDs are ids of libraries in the Library combobox, the first entry is all libraries
+	libraryIDs []string
+	// found are books of authors found by the full-text search, nil when searching by authors
+	found map[string][]*entities.Book
+	// bySeries shows series instead of authors in the left pane
+	bySeries bool
+	// loading is set while a catalog is parsed in background, handlers wrapped by idle are ignored then
+	loading bool
+	// Facets are listboxes of the filter panel, facetValues are values listed in them in order
+	Facets      map[entities.Facet]*ListboxWidget
+	facetValues map[entities.Facet][]string
+	// genreGroups are rows of genre categories in the genre facet, ticking one ticks all its genres
+	genreGroups map[int]genres.Group
 
 	app *app.App
 	log *zap.Logger
@@ -31,40 +53,155 @@ type MainForm struct {
 
 func (impl *MainForm) CreateMenubar() {
 	menubar := Menu()
-	menubar.AddCommand(Lbl("Open"), Underline(0), Accelerator("Ctrl+O"), Command(impl.openFile))
-	Bind(App, "<Control-o>", Command(func() { menubar.Invoke(1) }))
+	menubar.AddCommand(Lbl("Open"), Underline(0), Accelerator("Ctrl+O"), Command(impl.idle(impl.openFile)))
+	Bind(App, "<Control-o>", Command(impl.idle(impl.openFile)))
+	menubar.AddCommand(Lbl("Add library..."), Underline(0), Accelerator("Ctrl+L"), Command(impl.idle(impl.addLibrary)))
+	Bind(App, "<Control-l>", Command(impl.idle(impl.addLibrary)))
+	menubar.AddCommand(Lbl("Close library"), Underline(0), Command(impl.idle(impl.closeLibrary)))
+	menubar.AddCommand(Lbl("Merge update..."), Underline(0), Accelerator("Ctrl+M"), Command(impl.idle(impl.mergeFile)))
+	Bind(App, "<Control-m>", Command(impl.idle(impl.mergeFile)))
+	menubar.AddCommand(Lbl("Rebuild index"), Underline(0), Command(impl.idle(impl.rebuildIndex)))
 	menubar.AddSeparator()
-	menubar.AddCommand(Lbl("Export"), Underline(2), Accelerator("Ctrl+E"), Command(impl.exportFiles))
-	Bind(App, "<Control-s>", Command(func() { menubar.Invoke(2) }))
+	menubar.AddCommand(Lbl("Export"), Underline(2), Accelerator("Ctrl+E"), Command(impl.idle(impl.exportFiles)))
+	Bind(App, "<Control-s>", Command(impl.idle(impl.exportFiles)))
+	menubar.AddCommand(Lbl("Export catalog..."), Underline(7), Command(impl.idle(impl.exportCatalog)))
+	menubar.AddCommand(Lbl("Export library..."), Underline(7), Command(impl.idle(impl.exportLibrary)))
 	menubar.AddSeparator()
-	menubar.AddCommand(Lbl("About"), Underline(0), Command(impl.showAbout))
-	Bind(App, "<Control-a>", Command(func() { menubar.Invoke(3) }))
+	menubar.AddCascade(Lbl("View"), Underline(0), Mnu(impl.CreateViewMenu()))
+	menubar.AddCascade(Lbl("Genres"), Underline(0), Mnu(impl.CreateGenresMenu()))
+	menubar.AddCascade(Lbl("Names"), Underline(0), Mnu(impl.CreateNamesMenu()))
+	menubar.AddCascade(Lbl("Sorting"), Underline(0), Mnu(impl.CreateSortingMenu()))
+	menubar.AddCascade(Lbl("Duplicates"), Underline(0), Mnu(impl.CreateDuplicatesMenu()))
+	menubar.AddCascade(Lbl("Encoding"), Underline(1), Mnu(impl.CreateEncodingMenu()))
+	menubar.AddCommand(Lbl("Archive mapping..."), Underline(1), Command(impl.idle(impl.showArchiveMapping)))
 	menubar.AddSeparator()
-	menubar.AddCommand(Lbl("Exit"), Underline(1), Accelerator("Ctrl+Q"), ExitHandler())
-	Bind(App, "<Control-q>", Command(func() { menubar.Invoke(4) }))
+	menubar.AddCommand(Lbl("About"), Underline(0), Command(impl.idle(impl.showAbout)))
+	Bind(App, "<Control-a>", Command(impl.idle(impl.showAbout)))
+	menubar.AddSeparator()
+	exitItem := menubar.AddCommand(Lbl("Exit"), Underline(1), Accelerator("Ctrl+Q"), ExitHandler())
+	Bind(App, "<Control-q>", Command(func() { menubar.Invoke(uint(menubar.Index(exitItem))) }))
 
 	impl.Menubar = menubar
 }
 
+func (impl *MainForm) CreateViewMenu() *MenuWidget {
+	menu := Menu(Tearoff(false))
+	menu.AddCommand(Lbl("Browse by authors"), Command(impl.idle(func() { impl.setBrowseMode(false) })))
+	menu.AddCommand(Lbl("Browse by series"), Command(impl.idle(func() { impl.setBrowseMode(true) })))
+	return menu
+}
+
+func (impl *MainForm) CreateGenresMenu() *MenuWidget {
+	menu := Menu(Tearoff(false))
+	menu.AddCommand(Lbl("English names"), Command(impl.idle(func() { impl.setGenreLang(genres.English) })))
+	menu.AddCommand(Lbl("Russian names"), Command(impl.idle(func() { impl.setGenreLang(genres.Russian) })))
+	return menu
+}
+
+func (impl *MainForm) CreateNamesMenu() *MenuWidget {
+	menu := Menu(Tearoff(false))
+	for _, format := range entities.NameFormats {
+		menu.AddCommand(Lbl(format.String()), Command(impl.idle(func() { impl.setNameFormat(format) })))
+	}
+	return menu
+}
+
+func (impl *MainForm) CreateSortingMenu() *MenuWidget {
+	menu := Menu(Tearoff(false))
+	for _, locale := range collation.Locales {
+		menu.AddCommand(Lbl(locale.String()+" order"), Command(impl.idle(func() { impl.setLocale(locale) })))
+	}
+	return menu
+}
+
+func (impl *MainForm) CreateDuplicatesMenu() *MenuWidget {
+	menu := Menu(Tearoff(false))
+	for _, policy := range inp.DuplicatePolicies {
+		menu.AddCommand(Lbl(duplicatePolicyText(policy)), Command(impl.idle(func() { impl.setDuplicatePolicy(policy) })))
+	}
+	return menu
+}
+
+func (impl *MainForm) CreateEncodingMenu() *MenuWidget {
+	menu := Menu(Tearoff(false))
+	for _, encoding := range inp.Encodings {
+		menu.AddCommand(Lbl(encoding.String()), Command(impl.idle(func() { impl.setEncoding(encoding) })))
+	}
+	return menu
+}
+
 func (impl *MainForm) CreateFind() *TFrameWidget {
 	// find
 	fr := TFrame()
 	eVal := Textvariable("")
 	findInput := fr.TEntry(eVal)
-	Bind(findInput, "<Return>", Command(impl.findAuthor))
+	Bind(findInput, "<Return>", Command(impl.idle(impl.findAuthor)))
 	findLabel := fr.Label(Txt("Find"))
-	clearBtn := fr.Button(Txt("❌"), Width(1), Height(1), Command(impl.clearFind))
-	findBtn := fr.Button(Txt("🔍"), Width(1), Height(1), Command(impl.findAuthor))
+	clearBtn := fr.Button(Txt("❌"), Width(1), Height(1), Command(impl.idle(impl.clearFind)))
+	findBtn := fr.Button(Txt("🔍"), Width(1), Height(1), Command(impl.idle(impl.findAuthor)))
+	ratingLabel := fr.Label(Txt("Min rating"))
+	minRating := fr.TSpinbox(From(0), To(5), Increment(1), Width(2), Textvariable("0"), State("readonly"), Command(impl.idle(impl.findAuthor)))
+	sortLabel := fr.Label(Txt("Sort by"))
+	bookOrder := fr.TCombobox(Values(bookOrders()), State("readonly"), Width(8), Textvariable(impl.app.BookOrder().String()))
+	Bind(bookOrder, "<<ComboboxSelected>>", Command(impl.idle(impl.changeBookOrder)))
+	deletedLabel := fr.Label(Txt("Deleted books"))
+	deletedMode := fr.TCombobox(Values(deletedModes()), State("readonly"), Width(8), Textvariable(inp.ExcludeDeleted.String()))
+	Bind(deletedMode, "<<ComboboxSelected>>", Command(impl.idle(impl.changeDeletedMode)))
+	libraryLabel := fr.Label(Txt("Library"))
+	library := fr.TCombobox(Values([]string{allLibraries}), State("readonly"), Width(20), Textvariable(allLibraries))
+	Bind(library, "<<ComboboxSelected>>", Command(impl.idle(impl.findAuthor)))
+	searchInLabel := fr.Label(Txt("Search in"))
+	searchIn := fr.TCombobox(Values(searchScopes), State("readonly"), Width(10), Textvariable(searchScopes[searchAuthors]))
+	Bind(searchIn, "<<ComboboxSelected>>", Command(impl.idle(impl.findAuthor)))
 	Pack(findLabel, Side("left"))
 	Pack(findInput, Side("left"), Expand(true), Fill("x"))
+	Pack(searchInLabel, Side("left"), Padx("1m"))
+	Pack(searchIn, Side("left"))
 	Pack(findBtn, Side("right"), Expand(false), Fill("x"))
 	Pack(clearBtn, Side("right"), Expand(false), Fill("x"))
+	Pack(library, Side("right"), Padx("1m"))
+	Pack(libraryLabel, Side("right"))
+	Pack(deletedMode, Side("right"), Padx("1m"))
+	Pack(deletedLabel, Side("right"))
+	Pack(bookOrder, Side("right"), Padx("1m"))
+	Pack(sortLabel, Side("right"))
+	Pack(minRating, Side("right"), Padx("1m"))
+	Pack(ratingLabel, Side("right"))
 	impl.FindInput = findInput
+	impl.DeletedMode = deletedMode
+	impl.MinRating = minRating
+	impl.BookOrder = bookOrder
+	impl.Library = library
+	impl.SearchIn = searchIn
+	impl.libraryIDs = []string{""}
 	impl.FindValue = &eVal
 
 	return fr
 }
 
+func (impl *MainForm) CreateFacetPanel() *TFrameWidget {
+	fr := TFrame()
+	impl.Facets = make(map[entities.Facet]*ListboxWidget, len(entities.Facets))
+	impl.facetValues = make(map[entities.Facet][]string, len(entities.Facets))
+	for _, facet := range entities.Facets {
+		label := fr.Label(Txt(facetTitle(facet)), Anchor("w"))
+		Pack(label, Fill("x"))
+		listFrame := fr.TFrame()
+		sb := listFrame.TScrollbar()
+		Pack(sb, Side("right"), Fill("y"))
+		lb := listFrame.Listbox(Selectmode("multiple"), Exportselection(false), Width(28), Height(10),
+			Yscrollcommand(func(e *Event) { e.ScrollSet(sb) }))
+		Pack(lb, Expand(true), Fill("both"))
+		sb.Configure(Command(func(e *Event) { e.Yview(lb) }))
+		Bind(lb, "<<ListboxSelect>>", Command(impl.idle(impl.findAuthor)))
+		Pack(listFrame, Expand(true), Fill("both"), Pady("1m"))
+		impl.Facets[facet] = lb
+	}
+	clearBtn := fr.TButton(Txt("Clear filters"), Command(impl.idle(impl.clearFacets)))
+	Pack(clearBtn, Fill("x"))
+	return fr
+}
+
 func (impl *MainForm) CreateAuthorList() *TFrameWidget {
 	// Lists
 	// Authors
@@ -78,12 +215,13 @@ func (impl *MainForm) CreateAuthorList() *TFrameWidget {
 
 	lv.Heading("#0", Txt("Books by authors"), Anchor("center"))
 	lv.Column("#0", Width(500), Stretch(true), Separator(false))
+	lv.TagConfigure(deletedTag, Foreground("gray"))
 
 	Pack(lv, Expand(true), Fill("both"))
 	sb.Configure(Command(func(e *Event) { e.Yview(lv) }))
 	impl.AuthorList = lv
 
-	Bind(lv, "<<TreeviewOpen>>", Command(impl.authorListOpen))
+	Bind(lv, "<<TreeviewOpen>>", Command(impl.idle(impl.authorListOpen)))
 
 	return fr
 }
@@ -97,9 +235,9 @@ func (impl *MainForm) CreateResultList() *TFrameWidget {
 	Pack(buttonFrame, Side("left"), Padx("2p"), Anchor("center"))
 
 	// Two small buttons
-	addBtn := buttonFrame.Button(Txt("➡"), Width(1), Height(1), Command(impl.addToResultList))
-	removeBtn := buttonFrame.Button(Txt("⬅"), Width(1), Height(1), Command(impl.removeFromResultList))
-	clearBtn := buttonFrame.Button(Txt("❌"), Width(1), Height(1), Command(impl.clearResultList))
+	addBtn := buttonFrame.Button(Txt("➡"), Width(1), Height(1), Command(impl.idle(impl.addToResultList)))
+	removeBtn := buttonFrame.Button(Txt("⬅"), Width(1), Height(1), Command(impl.idle(impl.removeFromResultList)))
+	clearBtn := buttonFrame.Button(Txt("❌"), Width(1), Height(1), Command(impl.idle(impl.clearResultList)))
 
 	// Pack buttons in the button frame, centered vertically
 	Pack(addBtn, Side("top"), Pady("1p"))
@@ -115,6 +253,7 @@ func (impl *MainForm) CreateResultList() *TFrameWidget {
 
 	lv.Heading("#0", Txt("Books to export"), Anchor("center"))
 	lv.Column("#0", Width(600), Stretch(true), Separator(false))
+	lv.TagConfigure(deletedTag, Foreground("gray"))
 	Pack(lv, Expand(true), Fill("both"))
 	sb.Configure(Command(func(e *Event) { e.Yview(lv) }))
 	impl.ResultList = lv
@@ -140,23 +279,25 @@ func NewForm(logger *zap.Logger, app *app.App) *MainForm {
 	impl.CreateMenubar()
 
 	find := impl.CreateFind()
-	Grid(find, Row(0), Column(0), Sticky("we"), Padx("1m"), Pady("1m"))
+	Grid(find, Row(0), Column(0), Sticky("we"), Padx("1m"), Pady("1m"), Columnspan(2))
 
+	facets := impl.CreateFacetPanel()
+	Grid(facets, Row(1), Column(0), Sticky("nesw"), Padx("1m"))
 	authorList := impl.CreateAuthorList()
-	Grid(authorList, Row(1), Column(0), Sticky("nesw"))
+	Grid(authorList, Row(1), Column(1), Sticky("nesw"))
 	results := impl.CreateResultList()
-	Grid(results, Row(1), Column(1), Sticky("nesw"))
+	Grid(results, Row(1), Column(2), Sticky("nesw"))
 
 	statusbar := impl.CreateStatusbar()
-	Grid(statusbar, Row(2), Column(0), Sticky("we"), Columnspan(2))
+	Grid(statusbar, Row(2), Column(0), Sticky("we"), Columnspan(3))
 
-	GridColumnConfigure(App, 1, Weight(1))
+	GridColumnConfigure(App, 2, Weight(1))
 	GridRowConfigure(App, 1, Weight(1))
 
 	App.WmTitle(fmt.Sprintf("%s on %s", App.WmTitle("FreeLibrary"), runtime.GOOS))
 	ActivateTheme("azure light")
 	App.Configure(Mnu(impl.Menubar), Width("150c"), Height("6c"))
-	App.WmTitle("PoorBookExtractor")
+	impl.updateTitle()
 
 	App.IconPhoto(NewPhoto(Data(ico)))
 
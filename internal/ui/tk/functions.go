@@ -3,10 +3,18 @@ package ui
 import (
 	"fmt"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/HoskeOwl/PoorBookExtractor/internal/app"
+	"github.com/HoskeOwl/PoorBookExtractor/internal/collation"
 	"github.com/HoskeOwl/PoorBookExtractor/internal/entities"
+	"github.com/HoskeOwl/PoorBookExtractor/internal/genres"
+	"github.com/HoskeOwl/PoorBookExtractor/internal/query"
+	"github.com/HoskeOwl/PoorBookExtractor/internal/sources/inp"
+	"github.com/HoskeOwl/PoorBookExtractor/internal/storage"
 	"github.com/HoskeOwl/PoorBookExtractor/internal/version"
 	"go.uber.org/zap"
 	. "modernc.org/tk9.0"
@@ -14,29 +22,383 @@ import (
 )
 
 const (
-	EMPTY_ID = "@empty@"
+	EMPTY_ID     = "@empty@"
+	appTitle     = "PoorBookExtractor"
+	deletedTag   = "deleted"
+	allLibraries = "All libraries"
 )
 
+func deletedModes() []string {
+	modes := make([]string, 0, len(inp.DeletedModes))
+	for _, mode := range inp.DeletedModes {
+		modes = append(modes, mode.String())
+	}
+	return modes
+}
+
+func bookOrders() []string {
+	orders := make([]string, 0, len(entities.BookOrders))
+	for _, order := range entities.BookOrders {
+		orders = append(orders, order.String())
+	}
+	return orders
+}
+
+type searchScope int
+
+const (
+	searchAuthors searchScope = iota
+	searchTitles
+	searchEverything
+)
+
+// searchScopes are texts of the "Search in" selector in the order of searchScope values.
+var searchScopes = []string{"authors", "titles", "everything"}
+
+func duplicatePolicyText(policy inp.DuplicatePolicy) string {
+	switch policy {
+	case inp.KeepFirst:
+		return "Keep first"
+	case inp.KeepNewest:
+		return "Keep newest"
+	case inp.KeepBoth:
+		return "Keep both"
+	default:
+		return "Keep last"
+	}
+}
+
+func (impl *MainForm) bookText(book *entities.Book) string {
+	text := book.FullName()
+	if names := impl.app.GenreNames(book); len(names) > 0 {
+		text += " [" + strings.Join(names, ", ") + "]"
+	}
+	if book.Rating > 0 {
+		text += " " + strings.Repeat("★", book.Rating)
+	}
+	if book.Deleted {
+		text += " [deleted]"
+	}
+	return text
+}
+
+func bookTags(book *entities.Book) Opt {
+	if book.Deleted {
+		return Tags(deletedTag)
+	}
+	return Tags()
+}
+
+func (impl *MainForm) minRating() int {
+	rating, err := strconv.Atoi(impl.MinRating.Textvariable())
+	if err != nil {
+		return 0
+	}
+	return rating
+}
+
+// selectedLibrary returns the id of the library chosen in the find bar or empty string for all libraries.
+func (impl *MainForm) selectedLibrary() string {
+	idx, err := strconv.Atoi(impl.Library.Current(nil))
+	if err != nil || idx < 0 || idx >= len(impl.libraryIDs) {
+		return ""
+	}
+	return impl.libraryIDs[idx]
+}
+
+// searchScope returns what the find bar searches in, authors by default.
+func (impl *MainForm) searchScope() searchScope {
+	idx, err := strconv.Atoi(impl.SearchIn.Current(nil))
+	if err != nil || idx < 0 || idx >= len(searchScopes) {
+		return searchAuthors
+	}
+	return searchScope(idx)
+}
+
+func (impl *MainForm) bookFilter() entities.BookFilter {
+	filter := entities.BookFilter{MinRating: impl.minRating(), Source: impl.selectedLibrary()}
+	for _, facet := range entities.Facets {
+		filter = filter.Select(facet, impl.selectedFacetValues(facet))
+	}
+	return filter
+}
+
+func facetTitle(facet entities.Facet) string {
+	switch facet {
+	case entities.LangFacet:
+		return "Languages"
+	case entities.YearFacet:
+		return "Years"
+	default:
+		return "Genres"
+	}
+}
+
+// selectedFacetValues returns values ticked in the filter panel.
+func (impl *MainForm) selectedFacetValues(facet entities.Facet) []string {
+	values := impl.facetValues[facet]
+	selected := make([]string, 0)
+	for _, idx := range impl.Facets[facet].Curselection() {
+		// a ticked category stands for all its genres
+		if group, ok := impl.genreGroups[idx]; ok && facet == entities.GenreFacet {
+			for _, code := range group.Codes {
+				if !slices.Contains(selected, code) {
+					selected = append(selected, code)
+				}
+			}
+			continue
+		}
+		if idx < len(values) && !slices.Contains(selected, values[idx]) {
+			selected = append(selected, values[idx])
+		}
+	}
+	return selected
+}
+
+// groupGenres lists genres under their categories, rows of categories have empty values and are returned by row.
+func (impl *MainForm) groupGenres(codes []string) ([]string, map[int]genres.Group) {
+	rows := make([]string, 0, len(codes))
+	groups := make(map[int]genres.Group)
+	for _, group := range impl.app.GroupGenres(codes) {
+		groups[len(rows)] = group
+		rows = append(rows, "")
+		rows = append(rows, group.Codes...)
+	}
+	return rows, groups
+}
+
+func categoryText(name string) string {
+	if name == "" {
+		name = "Other"
+	}
+	return "▾ " + name
+}
+
+func (impl *MainForm) facetText(facet entities.Facet, value string, count int) string {
+	if facet == entities.GenreFacet {
+		value = impl.app.GenreName(value)
+	}
+	return fmt.Sprintf("%s (%d)", value, count)
+}
+
+// updateFacets recounts the filter panel keeping ticked values, shown are books of a search or nil for the whole list.
+func (impl *MainForm) updateFacets(shown []*entities.Book) {
+	filter := impl.bookFilter()
+	var counts storage.FacetCounts
+	if shown != nil {
+		counts = impl.app.CountFacets(shown, filter)
+	} else {
+		counts = impl.app.FacetCounts(filter)
+	}
+	for _, facet := range entities.Facets {
+		selected := filter.Selected(facet)
+		values := counts.Sorted(facet)
+		for _, value := range selected {
+			if !slices.Contains(values, value) {
+				values = append(values, value)
+			}
+		}
+		var groups map[int]genres.Group
+		if facet == entities.GenreFacet {
+			values, groups = impl.groupGenres(values)
+			impl.genreGroups = groups
+		}
+		lb := impl.Facets[facet]
+		lb.Delete(0, "end")
+		for idx, value := range values {
+			if group, ok := groups[idx]; ok {
+				lb.Insert("end", categoryText(group.Name))
+				continue
+			}
+			lb.Insert("end", impl.facetText(facet, value, counts[facet][value]))
+		}
+		for idx, value := range values {
+			if _, ok := groups[idx]; !ok && slices.Contains(selected, value) {
+				lb.SelectionSet(idx)
+			}
+		}
+		impl.facetValues[facet] = values
+	}
+}
+
+func (impl *MainForm) clearFacets() {
+	for _, lb := range impl.Facets {
+		lb.SelectionClear(0, "end")
+	}
+	impl.findAuthor()
+}
+
+// updateLibraries fills the library selector with loaded libraries keeping the selection if possible.
+func (impl *MainForm) updateLibraries() {
+	selected := impl.selectedLibrary()
+	titles := []string{allLibraries}
+	impl.libraryIDs = []string{""}
+	current := 0
+	for _, library := range impl.app.GetLibraries() {
+		if library.ID == selected {
+			current = len(titles)
+		}
+		titles = append(titles, library.Title())
+		impl.libraryIDs = append(impl.libraryIDs, library.ID)
+	}
+	impl.Library.Configure(Values(titles))
+	impl.Library.Current(current)
+}
+
+// nodes are the top level items of the left pane: authors or series in the series browsing mode.
+func (impl *MainForm) nodes(value string, filter entities.BookFilter) []string {
+	if impl.bySeries {
+		if value == "" {
+			return impl.app.ListSeries(filter)
+		}
+		return impl.app.SearchSeries(value, filter)
+	}
+	return impl.app.GetAuthorsFiltered(value, filter)
+}
+
+func (impl *MainForm) nodeName(key string) string {
+	if impl.bySeries {
+		return impl.app.SeriesName(key)
+	}
+	return impl.app.AuthorName(key)
+}
+
+// nodeKind names top level items in status messages.
+func (impl *MainForm) nodeKind() string {
+	if impl.bySeries {
+		return "series"
+	}
+	return "authors"
+}
+
+// nodeBooks returns books of a top level item of the left pane.
+func (impl *MainForm) nodeBooks(key string) []*entities.Book {
+	if impl.bySeries {
+		return impl.seriesBooks(key)
+	}
+	return impl.authorBooks(key)
+}
+
+// bookNodes returns keys of top level items the book is shown under.
+func (impl *MainForm) bookNodes(book *entities.Book) []string {
+	if impl.bySeries {
+		if key := book.SeriesKey(); key != "" {
+			return []string{key}
+		}
+		return nil
+	}
+	keys := make([]string, 0, len(book.Authors))
+	for _, author := range book.Authors {
+		keys = append(keys, author.Key())
+	}
+	return keys
+}
+
+// seriesBooks returns books of the series by number in it, the book order applies to authors only.
+func (impl *MainForm) seriesBooks(key string) []*entities.Book {
+	if found, ok := impl.found[key]; ok {
+		books := slices.Clone(found)
+		impl.app.SortSeriesBooks(books)
+		return books
+	}
+	return impl.app.GetSeriesBooksFiltered(key, impl.bookFilter())
+}
+
+// setBrowseMode switches the left pane between books by authors and books by series.
+func (impl *MainForm) setBrowseMode(bySeries bool) {
+	impl.bySeries = bySeries
+	heading := "Books by authors"
+	if bySeries {
+		heading = "Books by series"
+	}
+	impl.AuthorList.Heading("#0", Txt(heading))
+	impl.findAuthor()
+}
+
+// authorBooks returns books of the author filtered according to the find bar settings in the book order.
+// Books found by the full-text search are sorted the same way, authors keep the rank of their best book.
+func (impl *MainForm) authorBooks(author string) []*entities.Book {
+	if found, ok := impl.found[author]; ok {
+		books := slices.Clone(found)
+		impl.app.SortBooks(books)
+		return books
+	}
+	return impl.app.GetAuthorBooksFiltered(author, impl.bookFilter())
+}
+
+func (impl *MainForm) setGenreLang(lang genres.Lang) {
+	impl.app.SetGenreLang(lang)
+	impl.findAuthor()
+}
+
+func (impl *MainForm) setNameFormat(format entities.NameFormat) {
+	impl.app.SetNameFormat(format)
+	for _, author := range impl.ResultList.Children("") {
+		impl.ResultList.Item(author, Txt(impl.app.AuthorName(author)))
+	}
+	impl.findAuthor()
+}
+
+func (impl *MainForm) setLocale(locale collation.Locale) {
+	impl.app.SetLocale(locale)
+	impl.findAuthor()
+}
+
+func (impl *MainForm) changeBookOrder() {
+	impl.app.SetBookOrder(entities.ParseBookOrder(impl.BookOrder.Textvariable()))
+	impl.findAuthor()
+}
+
+func (impl *MainForm) changeDeletedMode() {
+	mode := inp.ParseDeletedMode(impl.DeletedMode.Textvariable())
+	impl.app.SetDeletedMode(mode)
+	impl.updateStatus(fmt.Sprintf("Deleted books mode: %s. It will be applied on the next open.", mode))
+}
+
+func (impl *MainForm) setDuplicatePolicy(policy inp.DuplicatePolicy) {
+	impl.app.SetDuplicatePolicy(policy)
+	impl.updateStatus(fmt.Sprintf("Duplicate books: %s. It will be applied on the next open.", strings.ToLower(duplicatePolicyText(policy))))
+}
+
+func (impl *MainForm) setEncoding(encoding inp.Encoding) {
+	impl.app.SetEncoding(encoding)
+	impl.updateStatus(fmt.Sprintf("Encoding of inp files: %s. It will be applied on the next open.", encoding))
+}
+
 func (impl *MainForm) updateStatus(text string) {
 	impl.Statusbar.Configure(Txt(text))
 }
 
+func (impl *MainForm) updateTitle() {
+	libraries := impl.app.GetLibraries()
+	switch len(libraries) {
+	case 0:
+		App.WmTitle(appTitle)
+	case 1:
+		App.WmTitle(fmt.Sprintf("%s - %s", appTitle, libraries[0].Title()))
+	default:
+		App.WmTitle(fmt.Sprintf("%s - %d libraries", appTitle, len(libraries)))
+	}
+}
+
 func (impl *MainForm) clearLists() {
 	impl.ResultList.Delete(impl.ResultList.Children(""))
 	impl.AuthorList.Delete(impl.AuthorList.Children(""))
 }
 
 func (impl *MainForm) refreshAuthorList() {
+	impl.found = nil
 	impl.AuthorList.Delete(impl.AuthorList.Children(""))
 	impl.updateStatus("Refreshing list...")
 	Update()
 	impl.AuthorList.Busy()
-	for _, author := range impl.app.GetAuthors("") {
-		impl.AuthorList.Insert("", "end", Id(author), Txt(author))
-		emptyId := author + ":" + EMPTY_ID
-		impl.AuthorList.Insert(author, "end", Id(emptyId), Txt(emptyId))
+	for _, node := range impl.nodes("", impl.bookFilter()) {
+		impl.AuthorList.Insert("", "end", Id(node), Txt(impl.nodeName(node)))
+		emptyId := node + ":" + EMPTY_ID
+		impl.AuthorList.Insert(node, "end", Id(emptyId), Txt(emptyId))
 	}
 	impl.AuthorList.BusyForget()
+	impl.updateFacets(nil)
 	impl.updateStatus("Refreshing list... done")
 	Update()
 }
@@ -49,10 +411,9 @@ func (impl *MainForm) authorListOpen() {
 		children := impl.AuthorList.Children(author)
 		if len(children) > 0 && children[0] == emptyId {
 			impl.AuthorList.Delete(emptyId)
-			books := impl.app.GetAuthorBooks(author)
-			impl.app.SortBooks(books)
+			books := impl.nodeBooks(author)
 			for _, book := range books {
-				impl.AuthorList.Insert(author, "end", Id(book.ExtendId(author)), Txt(book.FullName()))
+				impl.AuthorList.Insert(author, "end", Id(book.ExtendId(author)), Txt(impl.bookText(book)), bookTags(book))
 			}
 			Update()
 		}
@@ -66,20 +427,94 @@ func (impl *MainForm) clearFind() {
 }
 
 func (impl *MainForm) findAuthor() {
-	author := impl.FindInput.Textvariable()
-	if author == "" {
+	value := impl.FindInput.Textvariable()
+	if value == "" {
 		impl.refreshAuthorList()
 		return
 	}
 	impl.AuthorList.Delete(impl.AuthorList.Children(""))
-	for _, author := range impl.app.GetAuthors(author) {
-		books := impl.app.GetAuthorBooks(author)
-		impl.app.SortBooks(books)
-		impl.AuthorList.Insert("", "end", Id(author), Txt(author))
+	impl.found = nil
+	filter := impl.bookFilter()
+	if query.IsQualified(value) {
+		impl.updateFacets(impl.showAuthors(impl.queryBooks(value, filter)))
+		return
+	}
+	scope := impl.searchScope()
+	authors := make([]string, 0)
+	if scope != searchTitles {
+		authors = impl.nodes(value, filter)
+	}
+	if scope != searchAuthors {
+		authors = append(authors, impl.findBooks(value, filter, authors)...)
+	}
+	impl.updateFacets(impl.showAuthors(authors))
+}
+
+// showAuthors fills the left pane with authors or series and their books, it returns the shown books once each.
+func (impl *MainForm) showAuthors(authors []string) []*entities.Book {
+	shown := make([]*entities.Book, 0)
+	seen := make(map[*entities.Book]struct{})
+	for _, author := range authors {
+		books := impl.nodeBooks(author)
+		impl.AuthorList.Insert("", "end", Id(author), Txt(impl.nodeName(author)))
 		for _, book := range books {
-			impl.AuthorList.Insert(author, "end", Id(book.ExtendId(author)), Txt(book.FullName()))
+			impl.AuthorList.Insert(author, "end", Id(book.ExtendId(author)), Txt(impl.bookText(book)), bookTags(book))
+			if _, ok := seen[book]; !ok {
+				seen[book] = struct{}{}
+				shown = append(shown, book)
+			}
+		}
+	}
+	return shown
+}
+
+// findBooks runs the full-text search and groups found books by authors ordered by the best match.
+// Authors found by name are skipped, they show all their books anyway.
+func (impl *MainForm) findBooks(value string, filter entities.BookFilter, skip []string) []string {
+	matches := impl.app.SearchBooks(value, filter)
+	books := make([]*entities.Book, 0, len(matches))
+	for _, match := range matches {
+		books = append(books, match.Book)
+	}
+	authors := impl.groupFound(books, skip)
+	impl.updateStatus(fmt.Sprintf("Found %d books of %d %s.", len(books), len(authors), impl.nodeKind()))
+	return authors
+}
+
+// queryBooks runs the field-qualified query, authors are ordered by name and their books as usual.
+func (impl *MainForm) queryBooks(value string, filter entities.BookFilter) []string {
+	books, err := impl.app.QueryBooks(value, filter)
+	if err != nil {
+		impl.updateStatus(fmt.Sprintf("Query error: %s", err.Error()))
+		return nil
+	}
+	impl.app.SortBooks(books)
+	authors := impl.groupFound(books, nil)
+	impl.app.SortKeys(authors)
+	impl.updateStatus(fmt.Sprintf("Found %d books of %d %s.", len(books), len(authors), impl.nodeKind()))
+	return authors
+}
+
+// groupFound keeps found books by authors or series (see nodeBooks) and returns them in order of their first book.
+func (impl *MainForm) groupFound(books []*entities.Book, skip []string) []string {
+	skipped := make(map[string]struct{}, len(skip))
+	for _, key := range skip {
+		skipped[key] = struct{}{}
+	}
+	impl.found = make(map[string][]*entities.Book)
+	authors := make([]string, 0)
+	for _, book := range books {
+		for _, key := range impl.bookNodes(book) {
+			if _, ok := skipped[key]; ok {
+				continue
+			}
+			if _, ok := impl.found[key]; !ok {
+				authors = append(authors, key)
+			}
+			impl.found[key] = append(impl.found[key], book)
 		}
 	}
+	return authors
 }
 
 func (impl *MainForm) removeFromResultList() {
@@ -125,7 +560,7 @@ func (impl *MainForm) checkBookExistsInResult(item string) bool {
 					impl.log.Error("book from list not found", zap.String("book", item))
 					return true
 				}
-				impl.updateStatus(fmt.Sprintf("Author %s already contains book %s", parent, book.FullName()))
+				impl.updateStatus(fmt.Sprintf("Author %s already contains book %s", impl.app.AuthorName(parent), book.FullName()))
 				originalColor := impl.Statusbar.Background()
 				impl.Statusbar.Configure(Background("red"))
 				Update()
@@ -148,67 +583,91 @@ func (impl *MainForm) addToResultList() {
 	parent := impl.AuthorList.Parent(selected)
 	impl.log.Debug("addToResultList", zap.String("selected", selected), zap.String("parent", parent))
 	if parent == "" {
-		if !impl.checkAuthorExistsInResult(selected) {
-			// add author to result
-			impl.ResultList.Insert("", "end", Id(selected), Txt(selected))
-		}
-		books := impl.app.GetAuthorBooks(selected)
-		impl.app.SortBooks(books)
-		for _, book := range books {
-			if impl.checkBookExistsInResult(book.ExtendId(selected)) {
-				continue
-			}
-			impl.ResultList.Insert(selected, "end", Id(book.ExtendId(selected)), Txt(book.FullName()))
+		for _, book := range impl.nodeBooks(selected) {
+			impl.addBookToResult(impl.resultAuthor(selected, book), book)
 		}
-		impl.ResultList.Item(selected, Open(true))
 		return
 	}
-	if !impl.checkAuthorExistsInResult(parent) {
-		// add author to result
-		impl.ResultList.Insert("", "end", Id(parent), Txt(parent))
-	}
 	// book selected. So we have an book id
 	book, ok := impl.app.GetBook(entities.GetBookIdFromExtended(selected))
 	if !ok {
 		return
 	}
-	if impl.checkBookExistsInResult(book.ExtendId(parent)) {
+	impl.addBookToResult(impl.resultAuthor(parent, book), book)
+}
+
+// resultAuthor returns the author the book is exported under: the opened author or the first author of the book
+// when browsing by series.
+func (impl *MainForm) resultAuthor(node string, book *entities.Book) string {
+	if !impl.bySeries || len(book.Authors) == 0 {
+		return node
+	}
+	return book.Authors[0].Key()
+}
+
+func (impl *MainForm) addBookToResult(author string, book *entities.Book) {
+	if !impl.checkAuthorExistsInResult(author) {
+		// add author to result
+		impl.ResultList.Insert("", "end", Id(author), Txt(impl.app.AuthorName(author)))
+	}
+	if impl.checkBookExistsInResult(book.ExtendId(author)) {
 		return
 	}
-	impl.ResultList.Insert(parent, "end", Id(book.ExtendId(parent)), Txt(book.FullName()))
-	impl.ResultList.Item(parent, Open(true))
+	impl.ResultList.Insert(author, "end", Id(book.ExtendId(author)), Txt(impl.bookText(book)), bookTags(book))
+	impl.ResultList.Item(author, Open(true))
 }
 
 func (impl *MainForm) clearResultList() {
 	impl.ResultList.Delete(impl.ResultList.Children(""))
 }
 
-func (impl *MainForm) openFile() {
+func (impl *MainForm) chooseInpx(title string) string {
 	home := os.Getenv("HOME")
 	files := GetOpenFile(
 		Initialdir(home),
-		Title("Open library file"),
+		Title(title),
 		Multiple(false),
 		Filetypes(
 			[]FileType{
-				{"INPX files", []string{".inpx"}, ""},
+				{TypeName: "INPX files", Extensions: []string{".inpx"}},
 			},
 		),
 	)
+	return strings.Join(files, " ")
+}
 
-	filename := strings.Join(files, " ")
-
-	if len(files) == 0 {
-		return
+/*
+idle wraps a handler so it does nothing while a catalog is parsed in background.
+The parsing writes the storage, reading it meanwhile is a concurrent map access which crashes the program.
+*/
+func (impl *MainForm) idle(handler func()) func() {
+	return func() {
+		if impl.loading {
+			return
+		}
+		handler()
 	}
-	impl.log.Debug("open file", zap.String("file", filename))
-	impl.app.ClearStorage()
-	impl.clearLists()
+}
+
+/*
+parseWithProgress runs parsing in background and shows the progress in the status bar.
+The main window ignores the input until parsing is done, see idle.
+*/
+func (impl *MainForm) parseWithProgress(filename string, parse func() error) error {
+	impl.loading = true
+	App.Busy()
+	// the focused widget would still get keys
+	Focus(impl.Statusbar)
+	defer func() {
+		App.BusyForget()
+		Focus(impl.FindInput)
+		impl.loading = false
+	}()
 	var err error
 	done := make(chan struct{})
 	go func() {
 		defer func() { done <- struct{}{} }()
-		err = impl.app.ParseInpx(filename)
+		err = parse()
 	}()
 LOOP:
 	for {
@@ -223,12 +682,392 @@ LOOP:
 			time.Sleep(50 * time.Millisecond)
 		}
 	}
+	return err
+}
+
+// openFile replaces all loaded libraries with the chosen one.
+func (impl *MainForm) openFile() {
+	filename := impl.chooseInpx("Open library file")
+	if filename == "" {
+		return
+	}
+	impl.log.Debug("open file", zap.String("file", filename))
+	impl.app.ClearStorage()
+	impl.clearLists()
+	impl.loadLibrary(filename)
+}
+
+// addLibrary loads one more library next to already opened ones.
+func (impl *MainForm) addLibrary() {
+	filename := impl.chooseInpx("Add library file")
+	if filename == "" {
+		return
+	}
+	impl.log.Debug("add library", zap.String("file", filename))
+	impl.loadLibrary(filename)
+}
+
+func (impl *MainForm) loadLibrary(filename string) {
+	impl.updateTitle()
+	err := impl.parseWithProgress(filename, func() error {
+		return impl.app.ParseInpx(filename)
+	})
+	impl.updateLibraries()
+	impl.updateTitle()
 	if err != nil {
+		impl.refreshAuthorList()
 		impl.updateStatus(fmt.Sprintf("Error parsing file: %s", err.Error()))
 		return
 	}
-	impl.refreshAuthorList()
-	impl.updateStatus(fmt.Sprintf("Imported %d authors, %d books.", impl.app.AuthorsLen(), impl.app.BooksLen()))
+	impl.findAuthor()
+	status := fmt.Sprintf("Imported %d authors, %d books.", impl.app.AuthorsLen(), impl.app.BooksLen())
+	if report := impl.app.GetParseReport(); report != nil {
+		status += fmt.Sprintf(" Encoding %s.", report.EncodingSummary())
+	}
+	impl.updateStatus(status)
+	impl.checkParseReport()
+}
+
+// closeLibrary closes the library chosen in the find bar, the only one or asks to choose it.
+func (impl *MainForm) closeLibrary() {
+	id := impl.libraryForAction()
+	if id == "" {
+		return
+	}
+	library, _ := impl.app.GetLibraryByID(id)
+	if err := impl.app.CloseLibrary(id); err != nil {
+		impl.updateStatus(fmt.Sprintf("Error closing library: %s", err.Error()))
+		return
+	}
+	impl.updateLibraries()
+	impl.updateTitle()
+	impl.findAuthor()
+	impl.updateStatus(fmt.Sprintf("Closed %s. Loaded %d authors, %d books.", library.Title(), impl.app.AuthorsLen(), impl.app.BooksLen()))
+}
+
+// rebuildIndex parses the chosen library again ignoring its cached index.
+func (impl *MainForm) rebuildIndex() {
+	id := impl.libraryForAction()
+	if id == "" {
+		return
+	}
+	library, _ := impl.app.GetLibraryByID(id)
+	err := impl.parseWithProgress(library.Path, func() error {
+		return impl.app.RebuildIndex(id)
+	})
+	impl.updateLibraries()
+	impl.updateTitle()
+	if err != nil {
+		impl.refreshAuthorList()
+		impl.updateStatus(fmt.Sprintf("Error rebuilding index: %s", err.Error()))
+		return
+	}
+	impl.findAuthor()
+	impl.updateStatus(fmt.Sprintf("Rebuilt index of %s. Loaded %d authors, %d books.", library.Title(), impl.app.AuthorsLen(), impl.app.BooksLen()))
+	impl.checkParseReport()
+}
+
+// libraryForAction returns the library an action should be applied to or empty string if it can't be chosen.
+func (impl *MainForm) libraryForAction() string {
+	if id := impl.selectedLibrary(); id != "" {
+		return id
+	}
+	libraries := impl.app.GetLibraries()
+	switch len(libraries) {
+	case 0:
+		return ""
+	case 1:
+		return libraries[0].ID
+	default:
+		impl.updateStatus("Several libraries are loaded, choose one in the Library selector.")
+		return ""
+	}
+}
+
+func (impl *MainForm) mergeFile() {
+	filename := impl.chooseInpx("Merge library update")
+	if filename == "" {
+		return
+	}
+	impl.log.Debug("merge file", zap.String("file", filename))
+	id := ""
+	if len(impl.app.GetLibraries()) > 0 {
+		if id = impl.libraryForAction(); id == "" {
+			return
+		}
+	}
+	var summary *app.MergeSummary
+	err := impl.parseWithProgress(filename, func() error {
+		var err error
+		summary, err = impl.app.MergeInpx(id, filename)
+		return err
+	})
+	if err != nil {
+		impl.updateStatus(fmt.Sprintf("Error merging file: %s", err.Error()))
+		return
+	}
+	impl.updateLibraries()
+	impl.updateTitle()
+	impl.findAuthor()
+	impl.updateStatus(fmt.Sprintf("Merged %s: %d added, %d updated, %d removed.", filename, summary.Added, summary.Updated, summary.Removed))
+	impl.showMergeSummary(summary)
+	impl.checkParseReport()
+}
+
+func (impl *MainForm) showMergeSummary(summary *app.MergeSummary) {
+	if len(summary.Authors) == 0 {
+		return
+	}
+	summaryWindow := Toplevel()
+	summaryWindow.WmTitle("Merge summary")
+
+	mainFrame := summaryWindow.TFrame()
+	Pack(mainFrame, Expand(true), Fill("both"), Padx("2m"), Pady("2m"))
+
+	totalText := fmt.Sprintf("Added: %d, updated: %d, removed: %d", summary.Added, summary.Updated, summary.Removed)
+	totalLabel := mainFrame.Label(Txt(totalText), Justify("left"), Anchor("w"))
+	Pack(totalLabel, Fill("x"), Pady("1m"))
+
+	listFrame := mainFrame.TFrame()
+	Pack(listFrame, Expand(true), Fill("both"))
+	sb := listFrame.TScrollbar()
+	Pack(sb, Side("right"), Fill("y"))
+	lv := listFrame.TTreeview(Columns("author added updated removed"), Show("headings"), Height(20),
+		Yscrollcommand(func(e *Event) { e.ScrollSet(sb) }))
+	lv.Heading("author", Txt("Author"))
+	lv.Heading("added", Txt("Added"))
+	lv.Heading("updated", Txt("Updated"))
+	lv.Heading("removed", Txt("Removed"))
+	lv.Column("author", Width(400), Stretch(true))
+	lv.Column("added", Width(80), Stretch(false))
+	lv.Column("updated", Width(80), Stretch(false))
+	lv.Column("removed", Width(80), Stretch(false))
+	Pack(lv, Expand(true), Fill("both"))
+	sb.Configure(Command(func(e *Event) { e.Yview(lv) }))
+
+	for _, changes := range summary.Authors {
+		name := impl.app.FormatAuthor(changes.Author)
+		lv.Insert("", "end", Values([]string{name, strconv.Itoa(changes.Added), strconv.Itoa(changes.Updated), strconv.Itoa(changes.Removed)}))
+	}
+
+	closeBtn := mainFrame.Button(Txt("Close"), Command(func() { Destroy(summaryWindow) }))
+	Pack(closeBtn, Pady("1m"))
+
+	summaryWindow.Center()
+}
+
+func (impl *MainForm) checkParseReport() {
+	report := impl.app.GetParseReport()
+	if report == nil || (report.Skipped() == 0 && len(report.Collisions) == 0 && len(report.MissingArchives) == 0) {
+		return
+	}
+	problems := make([]string, 0, 3)
+	if report.Skipped() > 0 {
+		problems = append(problems, fmt.Sprintf("%d records skipped", report.Skipped()))
+	}
+	if len(report.Collisions) > 0 {
+		problems = append(problems, fmt.Sprintf("%d duplicate LibIDs", len(report.Collisions)))
+	}
+	if len(report.MissingArchives) > 0 {
+		problems = append(problems, fmt.Sprintf("%d archives not found", len(report.MissingArchives)))
+	}
+	impl.updateStatus(fmt.Sprintf("Imported %d authors, %d books. %s.", impl.app.AuthorsLen(), impl.app.BooksLen(), strings.Join(problems, ", ")))
+	answer := MessageBox(
+		Title("Parse report"),
+		Icon("warning"),
+		Msg(strings.Join(problems, ", ")),
+		Detail("View details?"),
+		Type("yesno"),
+	)
+	if answer == "yes" {
+		impl.showParseReport()
+	}
+}
+
+// maxReportRows limits rows of rejected records in the parse report, all of them can be saved to a file.
+const maxReportRows = 1000
+
+func (impl *MainForm) showParseReport() {
+	report := impl.app.GetParseReport()
+	if report == nil {
+		return
+	}
+	reportWindow := Toplevel()
+	reportWindow.WmTitle("Parse report")
+
+	mainFrame := reportWindow.TFrame()
+	Pack(mainFrame, Expand(true), Fill("both"), Padx("2m"), Pady("2m"))
+
+	// Summary by reason
+	summary := make([]string, 0)
+	for reason, count := range report.CountByKind() {
+		summary = append(summary, fmt.Sprintf("%s: %d", reason, count))
+	}
+	for _, failed := range report.Failed {
+		summary = append(summary, fmt.Sprintf("%s: %s", failed.Member, failed.Err))
+	}
+	slices.Sort(summary)
+	if encodings := report.EncodingSummary(); encodings != "" {
+		summary = append(summary, "Encoding "+encodings)
+	}
+	summaryLabel := mainFrame.Label(Txt(strings.Join(summary, "\n")), Justify("left"), Anchor("w"))
+	Pack(summaryLabel, Fill("x"), Pady("1m"))
+
+	// Records
+	listFrame := mainFrame.TFrame()
+	Pack(listFrame, Expand(true), Fill("both"))
+	sb := listFrame.TScrollbar()
+	Pack(sb, Side("right"), Fill("y"))
+	lv := listFrame.TTreeview(Columns("member line reason record"), Show("headings"), Height(20),
+		Yscrollcommand(func(e *Event) { e.ScrollSet(sb) }))
+	lv.Heading("member", Txt("File"))
+	lv.Heading("line", Txt("Line"))
+	lv.Heading("reason", Txt("Reason"))
+	lv.Heading("record", Txt("Record"))
+	lv.Column("member", Width(150), Stretch(false))
+	lv.Column("line", Width(60), Stretch(false))
+	lv.Column("reason", Width(150), Stretch(false))
+	lv.Column("record", Width(600), Stretch(true))
+	Pack(lv, Expand(true), Fill("both"))
+	sb.Configure(Command(func(e *Event) { e.Yview(lv) }))
+	for _, rejected := range report.Rejected[:min(len(report.Rejected), maxReportRows)] {
+		lv.Insert("", "end", Values([]string{rejected.Member, strconv.Itoa(rejected.Line), rejected.Reason(), rejected.Record()}))
+	}
+	if len(report.Rejected) > maxReportRows {
+		moreFrame := mainFrame.TFrame()
+		Pack(moreFrame, Fill("x"), Pady("1m"))
+		moreLabel := moreFrame.Label(Txt(fmt.Sprintf("Showing %d of %d records.", maxReportRows, len(report.Rejected))), Anchor("w"))
+		Pack(moreLabel, Side("left"))
+		saveBtn := moreFrame.Button(Txt("Save all..."), Command(impl.idle(impl.saveRejected)))
+		Pack(saveBtn, Side("left"), Padx("2m"))
+	}
+
+	// Duplicates
+	if len(report.Collisions) > 0 {
+		overlaps := make([]string, 0)
+		for archives, count := range report.OverlappingArchives() {
+			overlaps = append(overlaps, fmt.Sprintf("%s and %s share %d LibIDs", archives[0], archives[1], count))
+		}
+		slices.Sort(overlaps)
+		overlapLabel := mainFrame.Label(Txt(strings.Join(overlaps, "\n")), Justify("left"), Anchor("w"))
+		Pack(overlapLabel, Fill("x"), Pady("1m"))
+
+		duplicatesFrame := mainFrame.TFrame()
+		Pack(duplicatesFrame, Expand(true), Fill("both"))
+		dsb := duplicatesFrame.TScrollbar()
+		Pack(dsb, Side("right"), Fill("y"))
+		dv := duplicatesFrame.TTreeview(Columns("libid existing incoming resolution"), Show("headings"), Height(10),
+			Yscrollcommand(func(e *Event) { e.ScrollSet(dsb) }))
+		dv.Heading("libid", Txt("LibID"))
+		dv.Heading("existing", Txt("Loaded from"))
+		dv.Heading("incoming", Txt("Repeated in"))
+		dv.Heading("resolution", Txt("Resolution"))
+		dv.Column("libid", Width(100), Stretch(false))
+		dv.Column("existing", Width(200), Stretch(false))
+		dv.Column("incoming", Width(200), Stretch(false))
+		dv.Column("resolution", Width(300), Stretch(true))
+		Pack(dv, Expand(true), Fill("both"))
+		dsb.Configure(Command(func(e *Event) { e.Yview(dv) }))
+		for _, collision := range report.Collisions {
+			dv.Insert("", "end", Values([]string{collision.LibID, collision.Existing, collision.Incoming, collision.Resolution()}))
+		}
+	}
+
+	// Missing archives
+	if len(report.MissingArchives) > 0 {
+		missingLabel := mainFrame.Label(Txt("Archives not found, books of them can't be exported. Check the archive mapping."), Justify("left"), Anchor("w"))
+		Pack(missingLabel, Fill("x"), Pady("1m"))
+
+		missingFrame := mainFrame.TFrame()
+		Pack(missingFrame, Expand(true), Fill("both"))
+		msb := missingFrame.TScrollbar()
+		Pack(msb, Side("right"), Fill("y"))
+		mv := missingFrame.TTreeview(Columns("member archive books tried"), Show("headings"), Height(10),
+			Yscrollcommand(func(e *Event) { e.ScrollSet(msb) }))
+		mv.Heading("member", Txt("File"))
+		mv.Heading("archive", Txt("Archive"))
+		mv.Heading("books", Txt("Books"))
+		mv.Heading("tried", Txt("Tried"))
+		mv.Column("member", Width(150), Stretch(false))
+		mv.Column("archive", Width(200), Stretch(false))
+		mv.Column("books", Width(60), Stretch(false))
+		mv.Column("tried", Width(400), Stretch(true))
+		Pack(mv, Expand(true), Fill("both"))
+		msb.Configure(Command(func(e *Event) { e.Yview(mv) }))
+		for _, missing := range report.MissingArchives {
+			mv.Insert("", "end", Values([]string{missing.Member, missing.Archive, strconv.Itoa(missing.Books), strings.Join(missing.Tried, ", ")}))
+		}
+	}
+
+	closeBtn := mainFrame.Button(Txt("Close"), Command(func() { Destroy(reportWindow) }))
+	Pack(closeBtn, Pady("1m"))
+
+	reportWindow.Center()
+}
+
+// saveRejected saves all records rejected by parsing to a text file.
+func (impl *MainForm) saveRejected() {
+	home := os.Getenv("HOME")
+	filename := GetSaveFile(
+		Initialdir(home),
+		Title("Save rejected records"),
+		Defaultextension(".txt"),
+		Filetypes(
+			[]FileType{
+				{TypeName: "Text files", Extensions: []string{".txt"}},
+			},
+		),
+	)
+	if filename == "" {
+		return
+	}
+	if err := impl.app.SaveRejected(filename); err != nil {
+		impl.updateStatus(fmt.Sprintf("Error saving rejected records: %s", err.Error()))
+		return
+	}
+	impl.updateStatus(fmt.Sprintf("Saved %d rejected records to %s.", impl.app.GetParseReport().Skipped(), filename))
+}
+
+// showArchiveMapping edits the rule which maps inp names to archives, it is applied on the next open.
+func (impl *MainForm) showArchiveMapping() {
+	mappingWindow := Toplevel()
+	mappingWindow.WmTitle("Archive mapping")
+
+	mainFrame := mappingWindow.TFrame()
+	Pack(mainFrame, Expand(true), Fill("both"), Padx("2m"), Pady("2m"))
+
+	helpText := "Archives are looked up by the FOLDER column, then by the inp name.\n" +
+		"The rule below is tried last: the inp name is matched by the pattern and replaced.\n" +
+		"Example: ^(.*)\\.inp$ -> archives/$1.zip"
+	helpLabel := mainFrame.Label(Txt(helpText), Justify("left"), Anchor("w"))
+	Grid(helpLabel, Row(0), Column(0), Columnspan(2), Sticky("we"), Pady("1m"))
+
+	pattern, replacement := impl.app.ArchiveMapping()
+	patternLabel := mainFrame.Label(Txt("Pattern"))
+	patternInput := mainFrame.TEntry(Textvariable(pattern), Width(40))
+	replacementLabel := mainFrame.Label(Txt("Replacement"))
+	replacementInput := mainFrame.TEntry(Textvariable(replacement), Width(40))
+	Grid(patternLabel, Row(1), Column(0), Sticky("w"))
+	Grid(patternInput, Row(1), Column(1), Sticky("we"))
+	Grid(replacementLabel, Row(2), Column(0), Sticky("w"))
+	Grid(replacementInput, Row(2), Column(1), Sticky("we"))
+
+	buttons := mainFrame.TFrame()
+	Grid(buttons, Row(3), Column(0), Columnspan(2), Pady("1m"))
+	okBtn := buttons.Button(Txt("OK"), Command(impl.idle(func() {
+		err := impl.app.SetArchiveMapping(patternInput.Textvariable(), replacementInput.Textvariable())
+		if err != nil {
+			MessageBox(Title("Archive mapping"), Icon("error"), Msg("Invalid pattern"), Detail(err.Error()))
+			return
+		}
+		Destroy(mappingWindow)
+		impl.updateStatus("Archive mapping will be applied on the next open.")
+	})))
+	cancelBtn := buttons.Button(Txt("Cancel"), Command(func() { Destroy(mappingWindow) }))
+	Pack(okBtn, Side("left"), Padx("1m"))
+	Pack(cancelBtn, Side("left"), Padx("1m"))
+
+	mappingWindow.Center()
 }
 
 func (impl *MainForm) exportFiles() {
@@ -272,6 +1111,76 @@ func (impl *MainForm) exportFiles() {
 	impl.updateStatus(fmt.Sprintf("Exported %d books to %s", totalBooks, directory))
 }
 
+// resultBookKeys returns keys of books to export, a book added for several authors is returned once.
+func (impl *MainForm) resultBookKeys() []string {
+	keys := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, author := range impl.ResultList.Children("") {
+		for _, book := range impl.ResultList.Children(author) {
+			key := entities.GetBookIdFromExtended(book)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func (impl *MainForm) exportCatalog() {
+	keys := impl.resultBookKeys()
+	if len(keys) == 0 {
+		impl.updateStatus("Add books to export first.")
+		return
+	}
+	home := os.Getenv("HOME")
+	filename := GetSaveFile(
+		Initialdir(home),
+		Title("Save catalog"),
+		Defaultextension(".inpx"),
+		Filetypes(
+			[]FileType{
+				{TypeName: "INPX files", Extensions: []string{".inpx"}},
+			},
+		),
+	)
+	if filename == "" {
+		return
+	}
+	impl.log.Info("export catalog", zap.String("file", filename), zap.Int("count", len(keys)))
+	if err := impl.app.ExportCatalog(keys, filename); err != nil {
+		impl.updateStatus(fmt.Sprintf("Error exporting catalog: %s", err.Error()))
+		return
+	}
+	impl.updateStatus(fmt.Sprintf("Exported catalog of %d books to %s. Place it next to the library archives.", len(keys), filename))
+}
+
+// exportLibrary repacks books to export into a new library which can be opened on its own.
+func (impl *MainForm) exportLibrary() {
+	keys := impl.resultBookKeys()
+	if len(keys) == 0 {
+		impl.updateStatus("Add books to export first.")
+		return
+	}
+	home := os.Getenv("HOME")
+	directory := ChooseDirectory(
+		Initialdir(home),
+		Title("Select directory for the new library"),
+	)
+	if directory == "" {
+		return
+	}
+	impl.log.Info("export library", zap.String("directory", directory), zap.Int("count", len(keys)))
+	impl.updateStatus(fmt.Sprintf("Repacking %d books to %s...", len(keys), directory))
+	Update()
+	if err := impl.app.RepackBooks(keys, directory); err != nil {
+		impl.updateStatus(fmt.Sprintf("Error exporting library: %s", err.Error()))
+		return
+	}
+	impl.updateStatus(fmt.Sprintf("Exported library of %d books to %s", len(keys), directory))
+}
+
 func (impl *MainForm) showAbout() {
 	if impl.toplevel != nil {
 		return
@@ -279,7 +1188,7 @@ func (impl *MainForm) showAbout() {
 	// Create About window
 	aboutWindow := Toplevel()
 	impl.toplevel = aboutWindow
-	aboutWindow.WmTitle("About PoorBookExtractor")
+	aboutWindow.WmTitle("About " + appTitle)
 	aboutWindow.Configure(Width("40c"), Height("12c"))
 
 	// Main frame
@@ -287,7 +1196,7 @@ func (impl *MainForm) showAbout() {
 	Pack(mainFrame, Expand(true), Fill("both"), Padx("2m"), Pady("2m"))
 
 	// Title
-	titleLabel := mainFrame.Label(Txt("PoorBookExtractor"), Font("Arial 16 bold"))
+	titleLabel := mainFrame.Label(Txt(appTitle), Font("Arial 16 bold"))
 	Pack(titleLabel, Pady("1m"))
 
 	// Version info
@@ -295,6 +1204,20 @@ func (impl *MainForm) showAbout() {
 	versionLabel := mainFrame.Label(Txt(versionText), Justify("center"))
 	Pack(versionLabel, Pady("1m"))
 
+	// Loaded libraries info
+	for _, loaded := range impl.app.GetLibraries() {
+		library := loaded.Library
+		libraryText := fmt.Sprintf("Library: %s", loaded.Title())
+		if library.Version != "" {
+			libraryText += fmt.Sprintf("\nLibrary version: %s", library.Version)
+		}
+		if library.Description != "" {
+			libraryText += "\n" + library.Description
+		}
+		libraryLabel := mainFrame.Label(Txt(libraryText), Justify("center"))
+		Pack(libraryLabel, Pady("1m"))
+	}
+
 	// Close button
 	closeBtn := mainFrame.Button(Txt("Close"), Command(func() { Destroy(aboutWindow); impl.toplevel = nil }))
 	Pack(closeBtn, Pady("1m"))
@@ -39,6 +39,7 @@ func main() {
 	defer logger.Sync()
 	var mainForm *ui.MainForm
 	app := app.NewApp(logger)
+	defer app.Close()
 
 	mainForm = ui.NewForm(logger, app)
 	mainForm.Wait()